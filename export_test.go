@@ -0,0 +1,4 @@
+package picodi
+
+// ParseWireTag exposes parseWireTag to the tests
+var ParseWireTag = parseWireTag
@@ -0,0 +1,336 @@
+package picodi
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// typeOf returns the reflect.Type of T, even if T is an interface
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// RegisterTyped registers a typed accessor for T, usually from generated code,
+// that GetByType[T] will use, avoiding reflection.
+func RegisterTyped[T any](di *PicoDI, getter func(*PicoDI) (T, error)) error {
+	if di.frozen {
+		return ErrContainerFrozen
+	}
+	t := typeOf[T]()
+	if _, ok := di.typed[t]; ok {
+		return fmt.Errorf("typed accessor already registered: %s", t)
+	}
+	di.typed[t] = getter
+	return nil
+}
+
+// ProvideInterface registers the provider, a value or a function, for the interface I,
+// that takes precedence over any other implementation when resolving I.
+//
+//	picodi.ProvideInterface[Greeter](di, NewGreeter)
+func ProvideInterface[I any](di *PicoDI, provider interface{}) error {
+	it := typeOf[I]()
+	if it.Kind() != reflect.Interface {
+		return fmt.Errorf("type %s is not an interface", it)
+	}
+	v := reflect.ValueOf(provider)
+	if !v.IsValid() {
+		return fmt.Errorf("provider for interface %s cannot be nil", it)
+	}
+	pt := v.Type()
+	if pt.Kind() == reflect.Func && pt.NumOut() > 0 {
+		pt = providedType(pt.Out(0))
+	}
+	if pt.Kind() != reflect.Func && !pt.Implements(it) {
+		return fmt.Errorf("type %s provided for interface %s does not implement it", pt, it)
+	}
+	return di.namedProvider("", provider, false, func(inj *injector) {
+		inj.typ = it
+	})
+}
+
+// GetByType returns the instance for the type T.
+// If T is an interface, it resolves to the implementation that respects it.
+// Accessors registered with RegisterTyped take precedence.
+func GetByType[T any](r Resolver) (T, error) {
+	return getTyped[T](context.Background(), r.container())
+}
+
+// GetInterface returns the single implementation of the interface T,
+// or the one selected by ProvideInterface, BindInterface, BindInterfaceFunc or WithMostDerived.
+// Unlike GetByType[T], it fails if T is not an interface.
+func GetInterface[T any](r Resolver) (T, error) {
+	if t := typeOf[T](); t.Kind() != reflect.Interface {
+		var zero T
+		return zero, fmt.Errorf("type %s is not an interface", t)
+	}
+	return getTyped[T](context.Background(), r.container())
+}
+
+// GetByTypeContext is the same as GetByType[T] but the context is passed to the providers
+// with a context.Context argument, and the resolution is aborted if the context is cancelled.
+func GetByTypeContext[T any](ctx context.Context, r Resolver) (T, error) {
+	return getTyped[T](ctx, r.container())
+}
+
+// getTyped returns the instance for the type T, from the accessor registered with RegisterTyped, if any
+func getTyped[T any](ctx context.Context, di *PicoDI) (T, error) {
+	if getter, ok := di.typed[typeOf[T]()]; ok {
+		return getter.(func(*PicoDI) (T, error))(di)
+	}
+	v, _, err := di.getByType(ctx, typeOf[T](), false, false)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return cast[T](v)
+}
+
+// GetByTypeWithClean is the same as GetByType[T] but also returns the clean function.
+// For singletons the clean function is the one managed by the container, also called by Destroy().
+func GetByTypeWithClean[T any](r Resolver) (T, Clean, error) {
+	di := r.container()
+	v, clean, err := di.getByType(context.Background(), typeOf[T](), false, false)
+	return castWithClean[T](v, clean, err)
+}
+
+// ResolveWithClean is the same as Resolve[T] but also returns the clean function.
+// For singletons the clean function is the one managed by the container, also called by Destroy().
+func ResolveWithClean[T any](r Resolver, name string) (T, Clean, error) {
+	di := r.container()
+	v, clean, err := di.getByName(context.Background(), name, false, false)
+	return castWithClean[T](v, clean, err)
+}
+
+// GetTransient returns a new instance for the type T, even if the provider is not transient.
+// The returned clean function is the responsibility of the caller.
+func GetTransient[T any](r Resolver) (T, Clean, error) {
+	di := r.container()
+	v, clean, err := di.getByType(context.Background(), typeOf[T](), true, false)
+	return castWithClean[T](v, clean, err)
+}
+
+// Resolve returns the instance by name
+func Resolve[T any](r Resolver, name string) (T, error) {
+	di := r.container()
+	v, _, err := di.getByName(context.Background(), name, false, false)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return cast[T](v)
+}
+
+// ResolveAs returns the instance by name, converted to Target.
+// Unlike Resolve[T], the instance is also accepted if it can be converted to Target, of the same kind,
+// or if it is a non nil pointer to a value assignable to Target.
+func ResolveAs[Target any](r Resolver, name string) (Target, error) {
+	di := r.container()
+	var zero Target
+	v, _, err := di.getByName(context.Background(), name, false, false)
+	if err != nil {
+		return zero, err
+	}
+	if v == nil {
+		return cast[Target](v)
+	}
+	t := typeOf[Target]()
+	val := reflect.ValueOf(v)
+	switch {
+	case val.Type().AssignableTo(t):
+	case val.Kind() == t.Kind() && val.Type().ConvertibleTo(t):
+		// only between types of the same kind, eg: `string` to `Message`, to avoid lossy or panicking conversions
+		val = val.Convert(t)
+	case val.Kind() == reflect.Ptr && !val.IsNil() && val.Type().Elem().AssignableTo(t):
+		val = val.Elem()
+	default:
+		return zero, fmt.Errorf("provider '%s' of type %s cannot be converted to %s", name, val.Type(), t)
+	}
+	return val.Interface().(Target), nil
+}
+
+// GroupMembers returns the instances of all the members of the group, in registration order
+func GroupMembers[T any](r Resolver, group string) ([]T, error) {
+	di := r.container()
+	injs, ok := di.groups[group]
+	if !ok {
+		return nil, fmt.Errorf("%w for group %s", ErrProviderNotFound, group)
+	}
+	members := make([]T, 0, len(injs))
+	for _, inj := range injs {
+		v, _, err := di.get(context.Background(), inj, false, false)
+		if err != nil {
+			return nil, err
+		}
+		m, err := cast[T](v)
+		if err != nil {
+			return nil, fmt.Errorf("member %s of group %s: %w", inj.identifier(), group, err)
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// ResolveOr returns the instance by name, or the fallback if there is no provider for the name.
+// Any other failure is returned, eg: a missing dependency of the named provider.
+func ResolveOr[T any](r Resolver, name string, fallback T) (T, error) {
+	if !r.container().hasName(name) {
+		return fallback, nil
+	}
+	return Resolve[T](r, name)
+}
+
+// ResolveContext is the same as Resolve[T] but the context is passed to the providers
+// with a context.Context argument, and the resolution is aborted if the context is cancelled.
+func ResolveContext[T any](ctx context.Context, r Resolver, name string) (T, error) {
+	di := r.container()
+	v, _, err := di.getByName(ctx, name, false, false)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return cast[T](v)
+}
+
+// ResolveStrategy returns the instance of T registered, with RegisterStrategy, for the key
+func ResolveStrategy[T any](r Resolver, key interface{}) (T, error) {
+	di := r.container()
+	var zero T
+	inj, err := di.findStrategy(key, typeOf[T]())
+	if err != nil {
+		return zero, err
+	}
+	v, _, err := di.get(context.Background(), inj, false, false)
+	if err != nil {
+		return zero, err
+	}
+	return cast[T](v)
+}
+
+// Pipe composes two functions into one, to be registered as a provider of C that depends on A,
+// without registering the intermediate type B.
+//
+//	di.Providers(picodi.Pipe(LoadConfig, NewServer))
+func Pipe[A, B, C any](f func(A) B, g func(B) C) func(A) C {
+	return func(a A) C {
+		return g(f(a))
+	}
+}
+
+func castWithClean[T any](v interface{}, clean Clean, err error) (T, Clean, error) {
+	if err != nil {
+		var zero T
+		return zero, nil, err
+	}
+	t, err := cast[T](v)
+	if err != nil {
+		if clean != nil {
+			clean()
+		}
+		return t, nil, err
+	}
+	return t, clean, nil
+}
+
+func cast[T any](v interface{}) (T, error) {
+	t, ok := v.(T)
+	if ok {
+		return t, nil
+	}
+	target := typeOf[T]()
+	if v == nil {
+		switch target.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			// a nil instance is a valid zero value
+			return t, nil
+		}
+		return t, fmt.Errorf("resolved instance is nil, not assignable to type %s", target)
+	}
+	vt := reflect.TypeOf(v)
+	switch {
+	case vt == reflect.PtrTo(target), target == reflect.PtrTo(vt):
+		return t, fmt.Errorf("resolved instance of type %s is not of type %s: the provider returns %s, request %s not %s", vt, target, vt, vt, target)
+	case target.Kind() == reflect.Interface:
+		return t, fmt.Errorf("resolved instance of type %s does not implement %s", vt, target)
+	}
+	return t, fmt.Errorf("resolved instance of type %s is not of type %s", vt, target)
+}
+
+// ResolveWith returns a new instance of T, calling the function provider registered for T
+// with the supplied args and resolving the remaining arguments from the container.
+// Each arg is matched, by type, to the first available argument of the provider function.
+// The returned clean function, of the instance and of its dependencies, is the responsibility of the caller.
+func ResolveWith[T any](r Resolver, args ...interface{}) (T, Clean, error) {
+	di := r.container()
+	var zero T
+	t := typeOf[T]()
+	inj, err := di.findByType(t)
+	if err != nil {
+		return zero, nil, err
+	}
+	// the field of an Out struct is not provided by the function
+	if !inj.factory.IsValid() || providedType(inj.factory.Type().Out(0)) != inj.typ {
+		return zero, nil, fmt.Errorf("provider for type %s is not a function", t)
+	}
+
+	ft := inj.factory.Type()
+	supplied := make([]reflect.Value, ft.NumIn())
+	for _, arg := range args {
+		at := reflect.TypeOf(arg)
+		found := false
+		for i := 0; i < ft.NumIn(); i++ {
+			if !supplied[i].IsValid() && at != nil && at.AssignableTo(ft.In(i)) {
+				supplied[i] = reflect.ValueOf(arg)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return zero, nil, fmt.Errorf("no argument of provider function '%s' matches the supplied type %s", ft, at)
+		}
+	}
+
+	ctx := context.Background()
+	parameterized := &injector{
+		provider: func(ctx context.Context, dryRun bool) (interface{}, Clean, error) {
+			return di.funcInjectionWith(ctx, inj.factory, supplied, dryRun)
+		},
+		transient: true,
+		typ:       inj.typ,
+	}
+	v, clean, err := di.get(ctx, parameterized, true, false)
+	return castWithClean[T](v, clean, err)
+}
+
+// WireSlice wires all the items, like Wire(), resolving the wire tags of T, eg: expanding the variables, only once.
+// T must be a struct type. A clean function is returned to clean the dependencies of all the items.
+func WireSlice[T any](di *PicoDI, items []*T) (Clean, error) {
+	t := typeOf[T]()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("WireSlice requires a struct type, got %s", t)
+	}
+	var cleans []Clean
+	cleanAll := func() {
+		for _, c := range cleans {
+			c()
+		}
+		cleans = nil
+	}
+	tags := map[reflect.Type][]wireTag{}
+	for i, item := range items {
+		if item == nil {
+			cleanAll()
+			return nil, fmt.Errorf("item %d of the slice of %s is nil", i, t)
+		}
+		clean, err := di.wireFieldsWith(context.Background(), reflect.ValueOf(item), tags, false)
+		if err != nil {
+			cleanAll()
+			return nil, err
+		}
+		if clean != nil {
+			cleans = append(cleans, clean)
+		}
+	}
+	return cleanAll, nil
+}
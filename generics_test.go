@@ -0,0 +1,614 @@
+package picodi_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quintans/picodi"
+	"github.com/stretchr/testify/require"
+)
+
+type Number interface {
+	int | float64
+}
+
+type Calculator[T Number] struct {
+	Factor T
+}
+
+func (c Calculator[T]) Multiply(v T) T {
+	return c.Factor * v
+}
+
+type Multiplier[T Number] interface {
+	Multiply(v T) T
+}
+
+func TestGenericTypes(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(Calculator[int]{2}, Calculator[float64]{1.5})
+	require.NoError(t, err)
+
+	ci, err := picodi.GetByType[Calculator[int]](di)
+	require.NoError(t, err)
+	require.Equal(t, 4, ci.Multiply(2))
+
+	cf, err := picodi.GetByType[Calculator[float64]](di)
+	require.NoError(t, err)
+	require.Equal(t, 3.0, cf.Multiply(2))
+
+	v, _, err := di.GetByType(Calculator[int]{})
+	require.NoError(t, err)
+	require.Equal(t, ci, v)
+
+	v, _, err = di.GetByType(Calculator[float64]{})
+	require.NoError(t, err)
+	require.Equal(t, cf, v)
+
+	mi, err := picodi.GetByType[Multiplier[int]](di)
+	require.NoError(t, err)
+	require.Equal(t, 6, mi.Multiply(3))
+
+	mf, err := picodi.GetByType[Multiplier[float64]](di)
+	require.NoError(t, err)
+	require.Equal(t, 4.5, mf.Multiply(3))
+}
+
+func TestGenericResolve(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("calc", Calculator[int]{3})
+	require.NoError(t, err)
+
+	c, err := picodi.Resolve[Calculator[int]](di, "calc")
+	require.NoError(t, err)
+	require.Equal(t, 9, c.Multiply(3))
+
+	_, err = picodi.Resolve[Calculator[float64]](di, "calc")
+	require.Error(t, err)
+}
+
+func TestRegisterTyped(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(Calculator[int]{2})
+	require.NoError(t, err)
+
+	calc := Calculator[int]{5}
+	err = picodi.RegisterTyped(di, func(*picodi.PicoDI) (Calculator[int], error) {
+		return calc, nil
+	})
+	require.NoError(t, err)
+	err = picodi.RegisterTyped(di, func(*picodi.PicoDI) (Calculator[int], error) {
+		return calc, nil
+	})
+	require.Error(t, err)
+
+	c, err := picodi.GetByType[Calculator[int]](di)
+	require.NoError(t, err)
+	require.Equal(t, calc, c)
+	c, err = picodi.GetByTypeContext[Calculator[int]](context.Background(), di)
+	require.NoError(t, err)
+	require.Equal(t, calc, c)
+
+	err = picodi.RegisterTyped(di, func(*picodi.PicoDI) (Greeter, error) {
+		return GreeterImpl{Message: "typed"}, nil
+	})
+	require.NoError(t, err)
+	g, err := picodi.GetInterface[Greeter](di)
+	require.NoError(t, err)
+	require.Equal(t, Message("typed"), g.Greet())
+}
+
+func BenchmarkGetByTypeReflection(b *testing.B) {
+	di := picodi.New()
+	err := di.Providers(Calculator[int]{2})
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := picodi.GetByType[Calculator[int]](di)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetByTypeTyped(b *testing.B) {
+	di := picodi.New()
+	calc := Calculator[int]{2}
+	err := picodi.RegisterTyped(di, func(*picodi.PicoDI) (Calculator[int], error) {
+		return calc, nil
+	})
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := picodi.GetByType[Calculator[int]](di)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type ClientConfig struct {
+	Timeout time.Duration
+}
+
+type Client struct {
+	Config  ClientConfig
+	Greeter Greeter
+}
+
+func NewClient(cfg ClientConfig, g Greeter) *Client {
+	return &Client{Config: cfg, Greeter: g}
+}
+
+func TestResolveWith(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewMessage, NewGreeter, NewClient)
+	require.NoError(t, err)
+
+	_, err = picodi.GetByType[*Client](di)
+	require.Error(t, err)
+
+	c, _, err := picodi.ResolveWith[*Client](di, ClientConfig{Timeout: time.Second})
+	require.NoError(t, err)
+	require.Equal(t, time.Second, c.Config.Timeout)
+	require.Equal(t, Message("Hi there!"), c.Greeter.Greet())
+
+	_, _, err = picodi.ResolveWith[*Client](di, 1)
+	require.Error(t, err)
+
+	// the clean of the instance is returned
+	closed := false
+	di = picodi.New()
+	err = di.Providers(func(cfg ClientConfig) (*Client, picodi.Clean) {
+		return &Client{Config: cfg}, func() {
+			closed = true
+		}
+	})
+	require.NoError(t, err)
+	_, clean, err := picodi.ResolveWith[*Client](di, ClientConfig{})
+	require.NoError(t, err)
+	clean()
+	require.True(t, closed)
+}
+
+func TestGetTransient(t *testing.T) {
+	di := picodi.New()
+	err := di.TransientProviders(NewMessage, NewGreeter)
+	require.NoError(t, err)
+
+	g1, clean1, err := picodi.GetTransient[*GreeterImpl](di)
+	require.NoError(t, err)
+	g2, clean2, err := picodi.GetTransient[*GreeterImpl](di)
+	require.NoError(t, err)
+	require.NotSame(t, g1, g2)
+
+	require.NotEqual(t, -1, g1.Chaos)
+	clean1()
+	require.Equal(t, -1, g1.Chaos)
+	require.NotEqual(t, -1, g2.Chaos)
+	clean2()
+	require.Equal(t, -1, g2.Chaos)
+}
+
+func TestGetByTypeWithClean(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewMessage, NewGreeter)
+	require.NoError(t, err)
+
+	g1, clean, err := picodi.GetByTypeWithClean[*GreeterImpl](di)
+	require.NoError(t, err)
+	require.NotNil(t, clean)
+	g2, _, err := picodi.GetByTypeWithClean[Greeter](di)
+	require.NoError(t, err)
+	require.Same(t, g1, g2)
+
+	// singleton clean is managed by the container
+	require.NotEqual(t, -1, g1.Chaos)
+	di.Destroy()
+	require.Equal(t, -1, g1.Chaos)
+	// calling it after Destroy has no effect
+	clean()
+	require.Equal(t, -1, g1.Chaos)
+}
+
+func TestResolveWithClean(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewMessage)
+	require.NoError(t, err)
+	err = di.NamedTransientProvider("greeter", NewGreeter)
+	require.NoError(t, err)
+
+	g, clean, err := picodi.ResolveWithClean[*GreeterImpl](di, "greeter")
+	require.NoError(t, err)
+
+	// transient clean is managed by the caller
+	di.Destroy()
+	require.NotEqual(t, -1, g.Chaos)
+	clean()
+	require.Equal(t, -1, g.Chaos)
+}
+
+type LoudGreeter struct{}
+
+func (LoudGreeter) Greet() Message {
+	return "HI THERE!"
+}
+
+func TestAliasType(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewMessage, NewGreeter, LoudGreeter{})
+	require.NoError(t, err)
+
+	_, err = picodi.GetByType[Greeter](di)
+	require.Error(t, err)
+
+	err = di.AliasType((*Greeter)(nil), &GreeterImpl{})
+	require.NoError(t, err)
+	err = di.AliasType((*Greeter)(nil), Message(""))
+	require.Error(t, err)
+
+	g, err := picodi.GetByType[Greeter](di)
+	require.NoError(t, err)
+	gi, err := picodi.GetByType[*GreeterImpl](di)
+	require.NoError(t, err)
+	require.Same(t, gi, g)
+}
+
+func TestReadOnly(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewMessage, NewGreeter)
+	require.NoError(t, err)
+
+	var r picodi.Resolver = di.ReadOnly()
+	_, ok := r.(interface {
+		Providers(providers ...interface{}) error
+	})
+	require.False(t, ok, "read-only view should not be able to register")
+
+	g1, _, err := r.GetByType(&GreeterImpl{})
+	require.NoError(t, err)
+	g2, err := picodi.GetByType[*GreeterImpl](r)
+	require.NoError(t, err)
+	g3, err := picodi.GetByType[*GreeterImpl](di)
+	require.NoError(t, err)
+	require.Same(t, g1, g2)
+	require.Same(t, g2, g3)
+}
+
+func newBarDI() *picodi.PicoDI {
+	di := picodi.New()
+	di.NamedProvider("fooptr", &Foo{"Foo"})
+	di.NamedProvider("foo", Foo{"Foo"})
+	di.NamedProvider("foofn", func() Foo {
+		return Foo{"FooFn"}
+	})
+	di.Providers(Foo{"Foo"})
+	return di
+}
+
+func TestWireSlice(t *testing.T) {
+	di := newBarDI()
+	bars := []*Bar{{}, {}, {}}
+	_, err := picodi.WireSlice(di, bars)
+	require.NoError(t, err)
+	for _, b := range bars {
+		require.Equal(t, "Foo", b.Other.Name())
+		require.Equal(t, "FooFn", b.Fun.Name())
+		require.Equal(t, "Foo", b.FooPtr.Name())
+	}
+
+	_, err = picodi.WireSlice(di, []*Bar{{}, nil})
+	require.Error(t, err)
+
+	n := 1
+	_, err = picodi.WireSlice(di, []*int{&n})
+	require.Error(t, err)
+}
+
+func BenchmarkWire(b *testing.B) {
+	di := newBarDI()
+	bars := make([]*Bar, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range bars {
+			bars[j] = &Bar{}
+			_, err := di.Wire(bars[j])
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkWireSlice(b *testing.B) {
+	di := newBarDI()
+	bars := make([]*Bar, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range bars {
+			bars[j] = &Bar{}
+		}
+		_, err := picodi.WireSlice(di, bars)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGroupMembers(t *testing.T) {
+	di := picodi.New()
+	err := di.AddToGroup("http", Middleware{"auth"}, Middleware{"logging"}, &Middleware{"metrics"})
+	require.NoError(t, err)
+
+	handlers, err := picodi.GroupMembers[Handler](di, "http")
+	require.NoError(t, err)
+	require.Len(t, handlers, 3)
+	require.Equal(t, "auth", handlers[0].Handle())
+	require.Equal(t, "logging", handlers[1].Handle())
+	require.Equal(t, "metrics", handlers[2].Handle())
+
+	_, err = picodi.GroupMembers[Handler](di, "grpc")
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+}
+
+type requestIDKey struct{}
+
+func TestResolveContext(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedTransientProvider("request", func(ctx context.Context) Message {
+		return Message(fmt.Sprint(ctx.Value(requestIDKey{})))
+	})
+	require.NoError(t, err)
+	err = di.TransientProviders(func(ctx context.Context, m Message) *Foo {
+		return &Foo{string(m)}
+	})
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-1")
+	m, err := picodi.ResolveContext[Message](ctx, di, "request")
+	require.NoError(t, err)
+	require.Equal(t, Message("req-1"), m)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = picodi.GetByTypeContext[*Foo](ctx, di)
+	require.True(t, errors.Is(err, context.Canceled), err)
+}
+
+type Compression int
+
+const (
+	Fast Compression = iota
+	Best
+)
+
+func TestResolveStrategy(t *testing.T) {
+	di := picodi.New()
+	err := di.RegisterStrategy(Fast, Middleware{"fast"})
+	require.NoError(t, err)
+	err = di.RegisterStrategy(Best, func() Middleware { return Middleware{"best"} })
+	require.NoError(t, err)
+	err = di.RegisterStrategy(Best, Middleware{"other"})
+	require.Error(t, err)
+
+	m, err := picodi.ResolveStrategy[Middleware](di, Fast)
+	require.NoError(t, err)
+	require.Equal(t, "fast", m.Handle())
+
+	h, err := picodi.ResolveStrategy[Handler](di, Best)
+	require.NoError(t, err)
+	require.Equal(t, "best", h.Handle())
+
+	_, err = picodi.ResolveStrategy[Handler](di, 1)
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+	_, err = picodi.ResolveStrategy[Handler](di, []string{"x"})
+	require.EqualError(t, err, `strategy key must be comparable: []string{"x"}`)
+
+	// strategies are only resolved by key, but they are listed and instantiated with the others
+	_, err = picodi.GetByType[Middleware](di)
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+	require.Contains(t, di.String(), "picodi_test.Middleware: type=picodi_test.Middleware")
+	err = di.RegisterStrategy(Fast, func() (Handler, error) { return nil, errors.New("boom") })
+	require.NoError(t, err)
+	err = di.InstantiateAll()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "boom")
+}
+
+func TestPipe(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(
+		Message("hello"),
+		picodi.Pipe(
+			func(m Message) string { return strings.ToUpper(string(m)) },
+			func(s string) *Foo { return &Foo{s + "!"} },
+		),
+	)
+	require.NoError(t, err)
+
+	foo, err := picodi.GetByType[*Foo](di)
+	require.NoError(t, err)
+	require.Equal(t, "HELLO!", foo.Name())
+
+	_, err = picodi.GetByType[string](di)
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+}
+
+func TestResolveTypeMismatch(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("foo", &Foo{"Foo"})
+	require.NoError(t, err)
+
+	_, err = picodi.Resolve[Foo](di, "foo")
+	require.EqualError(t, err, "resolved instance of type *picodi_test.Foo is not of type picodi_test.Foo: the provider returns *picodi_test.Foo, request *picodi_test.Foo not picodi_test.Foo")
+
+	_, err = picodi.Resolve[Handler](di, "foo")
+	require.EqualError(t, err, "resolved instance of type *picodi_test.Foo does not implement picodi_test.Handler")
+}
+
+func TestProvideInterface(t *testing.T) {
+	di := picodi.New()
+	err := picodi.ProvideInterface[Greeter](di, NewGreeter)
+	require.NoError(t, err)
+	err = di.Providers(Message("hello"), &LoudGreeter{})
+	require.NoError(t, err)
+
+	_, err = di.DryRun(func(g Greeter) {})
+	require.NoError(t, err)
+	g, err := picodi.GetByType[Greeter](di)
+	require.NoError(t, err)
+	require.IsType(t, &GreeterImpl{}, g)
+
+	err = picodi.ProvideInterface[Greeter](di, func() *Foo { return &Foo{} })
+	require.Error(t, err)
+}
+
+func TestProfiles(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("", Middleware{"dev"}, picodi.WithProfile("dev"))
+	require.Error(t, err)
+	err = di.Provider(Middleware{"dev"}, picodi.WithProfile("dev"))
+	require.NoError(t, err)
+	err = di.Provider(Middleware{"prod"}, picodi.WithProfile("prod"))
+	require.NoError(t, err)
+	err = di.NamedProvider("db", &Foo{"prod-db"}, picodi.WithProfile("prod"))
+	require.NoError(t, err)
+
+	_, err = picodi.GetByType[Middleware](di)
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+
+	di.SetActiveProfiles("prod")
+	m, err := picodi.GetByType[Middleware](di)
+	require.NoError(t, err)
+	require.Equal(t, "prod", m.Handle())
+	h, err := picodi.GetByType[Handler](di)
+	require.NoError(t, err)
+	require.Equal(t, "prod", h.Handle())
+	db, err := picodi.Resolve[*Foo](di, "db")
+	require.NoError(t, err)
+	require.Equal(t, "prod-db", db.Name())
+
+	di.SetActiveProfiles("dev")
+	m, err = picodi.GetByType[Middleware](di)
+	require.NoError(t, err)
+	require.Equal(t, "dev", m.Handle())
+
+	// only the active profiles are collected
+	handlers, err := picodi.GetByType[[]Handler](di)
+	require.NoError(t, err)
+	require.Len(t, handlers, 1)
+	require.Equal(t, "dev", handlers[0].Handle())
+
+	// but all are listed
+	require.Contains(t, di.String(), "db: type=*picodi_test.Foo")
+
+	_, err = picodi.Resolve[Middleware](di, "")
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+}
+
+func TestProfilesAmbiguity(t *testing.T) {
+	di := picodi.New()
+	err := di.Provider(Middleware{"dev"}, picodi.WithProfile("dev"))
+	require.NoError(t, err)
+	err = di.Provider(&Middleware{"dev-ptr"}, picodi.WithProfile("dev"))
+	require.NoError(t, err)
+	err = di.NamedProvider("db", &Foo{"dev-db"}, picodi.WithProfile("dev"))
+	require.NoError(t, err)
+	di.SetActiveProfiles("dev")
+
+	_, err = picodi.GetByType[Handler](di)
+	require.True(t, errors.Is(err, picodi.ErrMultipleProvidersFound), err)
+	err = di.NamedProvider("router", func(h Handler) int { return 0 })
+	require.NoError(t, err)
+	err = di.AssertNoAmbiguity()
+	require.True(t, errors.Is(err, picodi.ErrMultipleProvidersFound), err)
+
+	enable := di.Disable("db")
+	_, err = picodi.Resolve[*Foo](di, "db")
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+	enable()
+	db, err := picodi.Resolve[*Foo](di, "db")
+	require.NoError(t, err)
+	require.Equal(t, "dev-db", db.Name())
+}
+
+func TestResolveOr(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("timeout", 5)
+	require.NoError(t, err)
+	err = di.NamedProvider("broken", func() (int, error) {
+		return 0, errors.New("boom")
+	})
+	require.NoError(t, err)
+	err = di.NamedProvider("retries", func(m Message) int {
+		return len(m)
+	})
+	require.NoError(t, err)
+
+	v, err := picodi.ResolveOr(di, "timeout", 10)
+	require.NoError(t, err)
+	require.Equal(t, 5, v)
+	v, err = picodi.ResolveOr(di, "delay", 10)
+	require.NoError(t, err)
+	require.Equal(t, 10, v)
+
+	_, err = picodi.ResolveOr(di, "broken", 10)
+	require.EqualError(t, err, "boom")
+	// the provider exists, so its missing dependency is not replaced by the fallback
+	_, err = picodi.ResolveOr(di, "retries", 10)
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+}
+
+func TestResolveAs(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("greeter", &GreeterImpl{Message: "hello"})
+	require.NoError(t, err)
+	err = di.NamedProvider("message", "hi")
+	require.NoError(t, err)
+
+	g, err := picodi.ResolveAs[Greeter](di, "greeter")
+	require.NoError(t, err)
+	require.Equal(t, Message("hello"), g.Greet())
+
+	// the pointer is dereferenced
+	impl, err := picodi.ResolveAs[GreeterImpl](di, "greeter")
+	require.NoError(t, err)
+	require.Equal(t, Message("hello"), impl.Message)
+
+	// convertible types
+	m, err := picodi.ResolveAs[Message](di, "message")
+	require.NoError(t, err)
+	require.Equal(t, Message("hi"), m)
+
+	_, err = picodi.ResolveAs[int](di, "greeter")
+	require.EqualError(t, err, "provider 'greeter' of type *picodi_test.GreeterImpl cannot be converted to int")
+
+	// conversions between kinds are rejected
+	err = di.NamedProvider("port", 5)
+	require.NoError(t, err)
+	_, err = picodi.ResolveAs[string](di, "port")
+	require.EqualError(t, err, "provider 'port' of type int cannot be converted to string")
+	err = di.NamedProvider("ids", []int{1})
+	require.NoError(t, err)
+	_, err = picodi.ResolveAs[*[2]int](di, "ids")
+	require.EqualError(t, err, "provider 'ids' of type []int cannot be converted to *[2]int")
+}
+
+func TestGetInterface(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewGreeter, Message("hello"))
+	require.NoError(t, err)
+
+	g, err := picodi.GetInterface[Greeter](di)
+	require.NoError(t, err)
+	require.Equal(t, Message("hello"), g.Greet())
+
+	_, err = picodi.GetInterface[*GreeterImpl](di)
+	require.EqualError(t, err, "type *picodi_test.GreeterImpl is not an interface")
+}
@@ -0,0 +1,168 @@
+package picodi
+
+import (
+	"reflect"
+	"time"
+)
+
+// Option configures a PicoDI instance
+type Option func(*PicoDI)
+
+// WithTypeKeyFunc sets the function that derives the name by which the providers registered by type can be resolved.
+// By default is the full type name, eg: `github.com/quintans/picodi/Foo`
+func WithTypeKeyFunc(fn func(reflect.Type) string) Option {
+	return func(di *PicoDI) {
+		di.typeKey = fn
+	}
+}
+
+// WithStrictUnexported, when strict, only allows writing directly to unexported fields without setter
+// if the field has the flag `unexported`, eg: `wire:"foo,unexported"`
+func WithStrictUnexported(strict bool) Option {
+	return func(di *PicoDI) {
+		di.strictUnexported = strict
+	}
+}
+
+// WithAsyncTimeout limits the time waiting for the value of a provider returning a channel, eg: `func() <-chan Foo`.
+// By default there is no limit.
+func WithAsyncTimeout(timeout time.Duration) Option {
+	return func(di *PicoDI) {
+		di.asyncTimeout = timeout
+	}
+}
+
+// WithUnderlyingMatch, when enabled, allows a dependency of a defined type, with no provider, to be satisfied
+// by converting the instance of a provider of the same kind, eg: a `Message` field from a `string` provider.
+func WithUnderlyingMatch(enabled bool) Option {
+	return func(di *PicoDI) {
+		di.underlyingMatch = enabled
+	}
+}
+
+// WithEagerValidate, when enabled, checks the direct dependencies of each provider on registration,
+// failing immediately on invalid or ambiguous dependencies.
+// Dependencies not registered yet are only checked by Init().
+func WithEagerValidate(enabled bool) Option {
+	return func(di *PicoDI) {
+		di.eagerValidate = enabled
+	}
+}
+
+// WithPointerToValue, when enabled, allows a dependency of type `*Foo`, with no provider, to be satisfied
+// by the provider of `Foo`. For singletons, the pointer is always to the same copy of the instance,
+// so changes through the pointer are shared by all the pointer dependencies but not by the value dependencies.
+func WithPointerToValue(enabled bool) Option {
+	return func(di *PicoDI) {
+		di.pointerToValue = enabled
+	}
+}
+
+// WithLenientPointers, when enabled, allows a dependency with no provider for its exact type to be satisfied
+// by the provider of the pointer type, eg: `Foo` from `*Foo`, getting a copy of the pointed value,
+// or by the provider of the value type, like WithPointerToValue. The exact type always takes precedence.
+func WithLenientPointers(enabled bool) Option {
+	return func(di *PicoDI) {
+		di.valueFromPointer = enabled
+		di.pointerToValue = enabled
+	}
+}
+
+// WithMostDerived, when enabled, resolves an interface with many implementations to the one that embeds all the others,
+// eg: a decorator embedding the decorated implementation. The bindings and selectors of the interface take precedence.
+func WithMostDerived(enabled bool) Option {
+	return func(di *PicoDI) {
+		di.mostDerived = enabled
+	}
+}
+
+// WithTransientTracking, when enabled, keeps the clean functions of the transient instances produced,
+// so that Destroy also cleans them. The clean functions are kept until Destroy is called.
+func WithTransientTracking(enabled bool) Option {
+	return func(di *PicoDI) {
+		di.trackTransients = enabled
+	}
+}
+
+// WithNameFromField, when enabled, resolves a field tagged without name, eg: `wire:""`,
+// by the provider named after the lowercased field name, if there is one, before resolving by type.
+func WithNameFromField(enabled bool) Option {
+	return func(di *PicoDI) {
+		di.fieldNames = enabled
+	}
+}
+
+// WithStats, when enabled, collects the resolution metrics returned by Stats()
+func WithStats(enabled bool) Option {
+	return func(di *PicoDI) {
+		di.collectStats = enabled
+	}
+}
+
+// WithCapacity preallocates the container for the expected number of providers
+func WithCapacity(capacity int) Option {
+	return func(di *PicoDI) {
+		di.capacity = capacity
+	}
+}
+
+// WithAutoClose, when enabled, calls Close() when cleaning the instances implementing io.Closer,
+// if their provider does not return a clean function
+func WithAutoClose(enabled bool) Option {
+	return func(di *PicoDI) {
+		di.autoClose = enabled
+	}
+}
+
+// WithMapKeyTypes registers more map key types, of kind string, to collect the named providers, like Named.
+// The key types are passed as zero values, eg: WithMapKeyTypes(ServiceID(""))
+func WithMapKeyTypes(keys ...interface{}) Option {
+	return func(di *PicoDI) {
+		for _, k := range keys {
+			if t := reflect.TypeOf(k); t != nil && t.Kind() == reflect.String {
+				di.keyTypes[t] = true
+			}
+		}
+	}
+}
+
+// ProviderOption configures a provider registration
+type ProviderOption func(*injector)
+
+// WithLabels labels the provider, to be queried with ProvidersWithLabel
+func WithLabels(labels ...string) ProviderOption {
+	return func(inj *injector) {
+		inj.labels = append(inj.labels, labels...)
+	}
+}
+
+// WithTypeRegistration makes a named provider to also be resolvable by its type
+func WithTypeRegistration() ProviderOption {
+	return func(inj *injector) {
+		inj.byType = true
+	}
+}
+
+// WithExcludeFromCollection excludes the provider from the slice and map collections, eg: a null object default.
+// The provider is still resolvable by name or by type, but only matches an interface if no other provider does.
+func WithExcludeFromCollection() ProviderOption {
+	return func(inj *injector) {
+		inj.excluded = true
+	}
+}
+
+// WithNoRewire skips the wiring of the fields of the provided instance, eg: an already configured instance,
+// only calling AfterWire if implemented.
+func WithNoRewire() ProviderOption {
+	return func(inj *injector) {
+		inj.noRewire = true
+	}
+}
+
+// WithProfile registers the provider for the profile, only being resolved or collected when the profile is active.
+// See SetActiveProfiles.
+func WithProfile(profile string) ProviderOption {
+	return func(inj *injector) {
+		inj.profile = profile
+	}
+}
@@ -1,16 +1,35 @@
 package picodi
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 	"unsafe"
 )
 
 const (
-	wireTagKey        = "wire"
-	wireFlagTransient = "transient"
+	wireTagKey         = "wire"
+	wireFlagTransient  = "transient"
+	wireFlagNamed      = "named"
+	wireFlagSetter     = "setter"
+	wireFlagUnexported = "unexported"
+	wireOptionWhen     = "when"
+)
+
+var (
+	// ErrContainerFrozen is returned when registering in a frozen container
+	ErrContainerFrozen = errors.New("container is frozen")
+	// ErrProviderNotFound is returned when no provider is found for a name or type
+	ErrProviderNotFound = errors.New("no provider was found")
+	// ErrMultipleProvidersFound is returned when an interface type has more than one implementation
+	ErrMultipleProvidersFound = errors.New("more than one implementation was found")
 )
 
 // Named defines the type for the key for the map that groups all the same types, distinguished by name
@@ -20,16 +39,60 @@ var (
 	namedType = reflect.TypeOf(Named(""))
 	errorType = reflect.TypeOf((*error)(nil)).Elem()
 	cleanType = reflect.TypeOf((*Clean)(nil)).Elem()
+	// mustSingletonType cannot be registered as transient
+	mustSingletonType = reflect.TypeOf((*MustSingleton)(nil)).Elem()
+	// contextType is injected with the resolution context
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	// cleanerType is injected with a new Cleaner for the provider
+	cleanerType = reflect.TypeOf((*Cleaner)(nil)).Elem()
 )
 
 type NamedProviders map[string]interface{}
 
+// In is a marker to be embedded in a struct used as a provider argument.
+// The struct will be wired, like in Wire(), before being passed to the provider.
+//
+//	type Deps struct {
+//		picodi.In
+//		Foo Foo `wire:"foo"`
+//	}
+type In struct{}
+
+// Out is a marker to be embedded in a struct returned by a provider.
+// Each exported field of the struct will be registered as a provider by type,
+// or by name if the field has the tag `name`.
+//
+//	type Result struct {
+//		picodi.Out
+//		Foo Foo `name:"foo"`
+//		Bar Bar
+//	}
+type Out struct{}
+
+const outNameTagKey = "name"
+
+// injectMethodName is the name of the method called by WireConstructor
+const injectMethodName = "Inject"
+
+var (
+	inType  = reflect.TypeOf(In{})
+	outType = reflect.TypeOf(Out{})
+)
+
 // AfterWirer is an interface for any implementation that wants to something after being wired.
 type AfterWirer interface {
 	AfterWire() (Clean, error)
 }
 
-type providerFunc func(dryRun bool) (interface{}, Clean, error)
+// AfterWirerContext is the same as AfterWirer but receives the container, eg: to resolve optional dependencies
+type AfterWirerContext interface {
+	AfterWire(di *PicoDI) (Clean, error)
+}
+
+type providerFunc func(ctx context.Context, dryRun bool) (interface{}, Clean, error)
+
+// ProviderInvocation calls the provider with the identifier, its name or type, returning the provided instance
+type ProviderInvocation func(identifier string) (interface{}, Clean, error)
 type Clean func()
 
 type injector struct {
@@ -38,23 +101,264 @@ type injector struct {
 	clean     Clean
 	transient bool
 	typ       reflect.Type
+	name      string
+	// factory is the provider function, if the provider is a function, or the one of the Out struct owning the field
+	factory reflect.Value
+	labels  []string
+	// byType, for a named provider, also registers it by type
+	byType bool
+	// stats are only collected with the option WithStats
+	stats ProviderStats
+	// transients counts the transient instances created
+	transients int
+	// addr is the stable pointer to a copy of the singleton instance, for the option WithPointerToValue
+	addr reflect.Value
+	// noRewire skips the wiring of the fields of the provided instance, only calling AfterWire
+	noRewire bool
+	// disabled makes the resolution by name to fail, see Disable()
+	disabled bool
+	// excluded from the collections and from the interface matches, unless there is no other match
+	excluded bool
+	// profile, if defined, only allows the provider to be resolved when the profile is active
+	profile string
+	// group, if defined, is the only way to resolve the provider
+	group string
+	// strategy, if defined, is the key, along with the type, that is the only way to resolve the provider
+	strategy interface{}
+	// contextual holds the instances by context, if the provider lifetime is bounded by a context
+	contextual *contextInstances
+	// generation identifies the current singleton instance, being incremented on every instantiation
+	generation int
+	// mu serializes the instantiation of the singleton
+	mu sync.Mutex
+}
+
+// contextInstances caches the instances of a provider by context
+type contextInstances struct {
+	mu        sync.Mutex
+	instances map[context.Context]*contextInstance
+}
+
+// boundContextKey is the context value key holding the context bounding the instance under construction
+type boundContextKey struct{}
+
+// contextInstance is the instance of a context, that can be read after ready is closed
+type contextInstance struct {
+	ready chan struct{}
+	value interface{}
+	err   error
+}
+
+// meta returns the registration metadata of the provider
+func (inj *injector) meta() ProviderMeta {
+	return ProviderMeta{
+		Name:      inj.name,
+		Type:      inj.typ,
+		Transient: inj.transient,
+		Labels:    append([]string{}, inj.labels...),
+	}
+}
+
+// satisfies checks if the provided type is of the same type or implements the interface t
+func (inj *injector) satisfies(t reflect.Type) bool {
+	return inj.typ == t || t.Kind() == reflect.Interface && inj.typ.Implements(t)
+}
+
+// valueOf returns the reflect.Value of v, or the zero value of t if v is nil
+func valueOf(v interface{}, t reflect.Type) reflect.Value {
+	if v == nil {
+		return reflect.Zero(t)
+	}
+	return reflect.ValueOf(v)
+}
+
+// identifier returns the name of the provider or, if not named, its type name
+func (inj *injector) identifier() string {
+	if inj.name != "" {
+		return inj.name
+	}
+	return inj.typ.String()
+}
+
+// Ordered is an interface for any implementation that wants to be sorted, by ascending order, when collected into a slice
+type Ordered interface {
+	Order() int
 }
 
+// Cleaner collects the clean functions of the resources acquired by a provider, when injected as an argument.
+// If the provider fails, they are called right away, otherwise they are called, after the provider clean, when the instance is cleaned.
+// They are called in reverse order.
+//
+//	di.Providers(func(c picodi.Cleaner) (*Repo, error) {
+//		db, err := openDB()
+//		if err != nil {
+//			return nil, err
+//		}
+//		c.Add(db.Close)
+//		cache, err := openCache() // if it fails, db is closed
+//		...
+//	})
+type Cleaner interface {
+	Add(clean Clean)
+}
+
+type cleaner struct {
+	cleans []Clean
+}
+
+func (c *cleaner) Add(clean Clean) {
+	c.cleans = append(c.cleans, clean)
+}
+
+func (c *cleaner) clean() {
+	for i := len(c.cleans) - 1; i >= 0; i-- {
+		c.cleans[i]()
+	}
+	c.cleans = nil
+}
+
+// MustSingleton is an interface for any implementation that can only be provided as a singleton, eg: a connection pool.
+// Registering its provider as transient fails.
+type MustSingleton interface {
+	PicoSingleton()
+}
+
+// Starter is an interface for any implementation that wants to be started by StartAll
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+// Stopper is an interface for any started implementation that wants to be stopped when StartAll fails
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// Logger is used to log the registrations, the instantiations and the cleanings
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+
 // PicoDI is a tiny framework for Dependency Injection.
 type PicoDI struct {
 	namedInjectors map[string]*injector
 	typeInjectors  map[reflect.Type]*injector
+	nameResolver   func(field reflect.StructField) string
+	bindings       map[reflect.Type]reflect.Type
+	selectors      map[reflect.Type]func(candidates []reflect.Type) reflect.Type
+	aliases        map[reflect.Type]*injector
+	fieldResolvers map[string]func(field reflect.StructField) (interface{}, error)
+	vars           map[string]string
+	forwards       map[string]string
+	plans          map[reflect.Type][]plannedField
+	frozen         bool
+	logger         Logger
+	// strictUnexported requires the flag `unexported` to write directly to unexported fields
+	strictUnexported bool
+	// typeKey derives the name by which providers registered by type can also be resolved
+	typeKey func(reflect.Type) string
+	// typeKeys holds the providers registered by type, by their type key
+	typeKeys map[string]*injector
+	// typed holds the accessors registered with RegisterTyped, by type
+	typed map[reflect.Type]interface{}
+	// parent resolves what is not found in a scope
+	parent *PicoDI
+	// profiled holds the injectors registered for each profile
+	profiled       map[string][]*injector
+	activeProfiles []string
+	// strategies holds the injectors registered with RegisterStrategy
+	strategies map[strategyKey]*injector
+	// groups holds the injectors added to each group, in registration order
+	groups map[string][]*injector
+	// keyTypes are the map key types, besides Named, used to collect named providers
+	keyTypes map[reflect.Type]bool
+	// capacity is the expected number of providers
+	capacity int
+	// order holds all the injectors in registration order
+	order []*injector
+	// created holds the singleton injectors in instantiation order
+	created      []*injector
+	onDestroyed  []func()
+	initializers []reflect.Value
+	// cleanAfter holds, by provider name, the names of the providers to be cleaned before it
+	cleanAfter map[string][]string
+	// missing are the handlers, by type, called when the type cannot be resolved
+	missing map[reflect.Type]func() (interface{}, error)
+	// factories register more providers on Init
+	factories []func(*PicoDI) error
+	// eagerValidate checks the dependencies of each provider on registration
+	eagerValidate bool
+	// pending holds the dependencies that were missing on registration, to be checked by Init
+	pending []pendingDependency
+	// pointerToValue allows a pointer dependency to be satisfied by the provider of the value type
+	pointerToValue bool
+	// valueFromPointer allows a value dependency to be satisfied by the provider of the pointer type
+	valueFromPointer bool
+	// mostDerived resolves an interface with many implementations to the one that embeds all the others
+	mostDerived bool
+	// fieldNames resolves the fields tagged without name by the lowercased field name, before resolving by type
+	fieldNames bool
+	// underlyingMatch allows a provider to satisfy a defined type of the same kind, by conversion
+	underlyingMatch bool
+	// asyncTimeout limits the wait for the value of a provider returning a channel
+	asyncTimeout time.Duration
+	// wrappers are the middlewares around every provider invocation
+	wrappers []func(next ProviderInvocation) ProviderInvocation
+	// trackTransients keeps the cleans of the transient instances, to be called by Destroy
+	trackTransients bool
+	// transientCleans are the tracked cleans
+	transientCleans []Clean
+	// collectStats collects the resolution metrics of the providers
+	collectStats bool
+	// autoClose cleans the instances implementing io.Closer, if the provider has no clean function
+	autoClose bool
+	// transientDisposer receives every transient instance produced
+	transientDisposer func(instance interface{}, clean Clean)
+	// mu guards the state shared by the concurrent resolutions of the providers bounded by a context
+	mu sync.Mutex
+	// retained holds the singletons, by generation, that are not cleaned by the cleans of the instances depending on them
+	retained map[*injector]int
 }
 
 // New creates a new PicoDI instance
-func New() *PicoDI {
-	return &PicoDI{
+func New(options ...Option) *PicoDI {
+	di := &PicoDI{
 		namedInjectors: map[string]*injector{},
 		typeInjectors:  map[reflect.Type]*injector{},
+		bindings:       map[reflect.Type]reflect.Type{},
+		selectors:      map[reflect.Type]func(candidates []reflect.Type) reflect.Type{},
+		aliases:        map[reflect.Type]*injector{},
+		fieldResolvers: map[string]func(field reflect.StructField) (interface{}, error){},
+		vars:           map[string]string{},
+		forwards:       map[string]string{},
+		plans:          map[reflect.Type][]plannedField{},
+		typed:          map[reflect.Type]interface{}{},
+		groups:         map[string][]*injector{},
+		strategies:     map[strategyKey]*injector{},
+		profiled:       map[string][]*injector{},
+		keyTypes:       map[reflect.Type]bool{},
+		missing:        map[reflect.Type]func() (interface{}, error){},
+		cleanAfter:     map[string][]string{},
+		typeKeys:       map[string]*injector{},
+		typeKey:        defaultTypeKey,
+		logger:         nopLogger{},
+	}
+	for _, o := range options {
+		o(di)
 	}
+	if di.capacity > 0 {
+		di.namedInjectors = make(map[string]*injector, di.capacity)
+		di.typeInjectors = make(map[reflect.Type]*injector, di.capacity)
+		di.order = make([]*injector, 0, di.capacity)
+	}
+	return di
 }
 
 // NamedProvider register a provider.
+//
 //	This is used like:
 //
 //	type Foo struct { Bar string }
@@ -66,14 +370,35 @@ func New() *PicoDI {
 //
 //	PicoDI.NamedProvider("foo", Foo{})
 //
-// In both cases an entry is also created for the full type name. eg: `github.com/quintans/picodi/Foo`
-// Registering with an empty name will only register with the full type name.
+// Providers registered without a name, by type, can also be resolved by name using the full type name. eg: `github.com/quintans/picodi/Foo`.
+// The type name format can be changed with the option WithTypeKeyFunc.
 // If the returned value of the provider is to be wired, it must return a pointer or interface
-func (di *PicoDI) NamedProvider(name string, provider interface{}) error {
+func (di *PicoDI) NamedProvider(name string, provider interface{}, options ...ProviderOption) error {
 	if name == "" {
 		return errors.New("name cannot be empty")
 	}
-	return di.namedProvider(name, provider, false)
+	return di.namedProvider(name, provider, false, options...)
+}
+
+// Provider registers a provider by type, like Providers, with options
+func (di *PicoDI) Provider(provider interface{}, options ...ProviderOption) error {
+	return di.namedProvider("", provider, false, options...)
+}
+
+// MustNamedProvider is the same as NamedProvider but panics on error
+func (di *PicoDI) MustNamedProvider(name string, provider interface{}) {
+	err := di.NamedProvider(name, provider)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// MustProvide is the same as Providers but panics on error
+func (di *PicoDI) MustProvide(providers ...interface{}) {
+	err := di.Providers(providers...)
+	if err != nil {
+		panic(err)
+	}
 }
 
 func (di *PicoDI) NamedProviders(providers NamedProviders) error {
@@ -120,14 +445,68 @@ func (di *PicoDI) TransientProviders(providers ...interface{}) error {
 	return nil
 }
 
-func (di *PicoDI) NamedTransientProvider(name string, provider interface{}) error {
+func (di *PicoDI) NamedTransientProvider(name string, provider interface{}, options ...ProviderOption) error {
+	if name == "" {
+		return errors.New("name cannot be empty")
+	}
+	return di.namedProvider(name, provider, true, options...)
+}
+
+// NamedContextProvider registers a provider whose instance is cached per resolution context, eg: WireContext(ctx, ...).
+// The instance is cleaned when the context is done, making it suitable for per connection resources.
+// The singletons it depends on are shared, so they are left to be cleaned by the container.
+// Resolving it requires a cancellable context.
+func (di *PicoDI) NamedContextProvider(name string, provider interface{}, options ...ProviderOption) error {
 	if name == "" {
 		return errors.New("name cannot be empty")
 	}
-	return di.namedProvider(name, provider, true)
+	options = append(options, func(inj *injector) {
+		inj.contextual = &contextInstances{instances: map[context.Context]*contextInstance{}}
+	})
+	return di.namedProvider(name, provider, false, options...)
+}
+
+// NamedForward makes the name to be resolved by the provider registered with the target name.
+// The target does not need to be already registered.
+func (di *PicoDI) NamedForward(name string, targetName string) error {
+	if di.frozen {
+		return ErrContainerFrozen
+	}
+	if name == "" || targetName == "" {
+		return errors.New("name cannot be empty")
+	}
+	if _, ok := di.namedInjectors[name]; ok {
+		return fmt.Errorf("name already registered: %s", name)
+	}
+	if _, ok := di.forwards[name]; ok {
+		return fmt.Errorf("name already forwarded: %s", name)
+	}
+	for t, ok := targetName, true; ok; t, ok = di.forwards[t] {
+		if t == name {
+			return fmt.Errorf("forwarding '%s' to '%s' creates a cycle", name, targetName)
+		}
+	}
+	di.forwards[name] = targetName
+	return nil
+}
+
+// NamedTransientClones registers the same provider as a transient for each of the names.
+// Each name has its own registration, sharing the provider.
+func (di *PicoDI) NamedTransientClones(provider interface{}, names ...string) error {
+	for _, name := range names {
+		err := di.NamedTransientProvider(name, provider)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (di *PicoDI) namedProvider(name string, provider interface{}, transient bool) error {
+func (di *PicoDI) namedProvider(name string, provider interface{}, transient bool, options ...ProviderOption) error {
+	if di.frozen {
+		return ErrContainerFrozen
+	}
 	v := reflect.ValueOf(provider)
 	t := v.Type()
 	var tn reflect.Type
@@ -139,41 +518,345 @@ func (di *PicoDI) namedProvider(name string, provider interface{}, transient boo
 			return err
 		}
 
-		fn = func(dryRun bool) (interface{}, Clean, error) {
-			return di.funcInjection(v, dryRun)
+		fn = func(ctx context.Context, dryRun bool) (interface{}, Clean, error) {
+			return di.funcInjection(ctx, v, dryRun)
 		}
-		tn = t.Out(0)
+		tn = providedType(t.Out(0))
 	} else {
-		fn = func(_ bool) (interface{}, Clean, error) {
+		fn = func(_ context.Context, _ bool) (interface{}, Clean, error) {
 			return provider, nil, nil
 		}
 		tn = t
 	}
 
-	inj := &injector{fn, nil, nil, transient, tn}
+	if transient && tn.Implements(mustSingletonType) {
+		return fmt.Errorf("type %s implements MustSingleton and cannot be registered as transient", tn)
+	}
+
+	inj := &injector{provider: fn, transient: transient, typ: tn}
+	if v.Kind() == reflect.Func {
+		inj.factory = v
+	}
+
+	if di.eagerValidate {
+		id := name
+		if id == "" {
+			id = tn.String()
+		}
+		if err := di.validateDependencies(id, inj); err != nil {
+			return err
+		}
+	}
+
+	if embedsType(tn, outType) {
+		if name != "" {
+			// the name would be lost, since only the fields are registered
+			return fmt.Errorf("provider of %s embeds picodi.Out and cannot be named '%s': name its fields with the tag `%s`", tn, name, outNameTagKey)
+		}
+		return di.outProviders(inj, options)
+	}
+
+	for _, o := range options {
+		o(inj)
+	}
+	return di.register(name, inj)
+}
+
+// AddToGroup registers the providers as members of the group, only resolvable through the group, eg: with GroupMembers[T].
+// Unlike the providers registered by type, many members can have the same type.
+func (di *PicoDI) AddToGroup(group string, providers ...interface{}) error {
+	if group == "" {
+		return errors.New("group cannot be empty")
+	}
+	for _, v := range providers {
+		err := di.namedProvider("", v, false, func(inj *injector) {
+			inj.group = group
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDependencies checks the direct dependencies of the provider against the providers registered so far.
+// Missing dependencies may be registered later, so they are only checked again by Init().
+func (di *PicoDI) validateDependencies(id string, inj *injector) error {
+	deps, err := di.dependencies(inj)
+	if err != nil {
+		return fmt.Errorf("invalid provider %s: %w", id, err)
+	}
+	for _, d := range deps {
+		err := di.checkDependency(d)
+		if errors.Is(err, ErrProviderNotFound) {
+			di.pending = append(di.pending, pendingDependency{provider: id, dependency: d})
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("invalid dependency %s of provider %s: %w", d.identifier(), id, err)
+		}
+	}
+	return nil
+}
+
+// checkDependency checks if there is a provider for the dependency, without instantiating it
+func (di *PicoDI) checkDependency(d dependency) error {
+	if d.resolved {
+		return nil
+	}
+	if d.name == "" && di.parentAlias(d.typ) {
+		return di.parent.checkDependency(d)
+	}
+	err := di.checkOwnDependency(d)
+	if errors.Is(err, ErrProviderNotFound) && di.parent != nil {
+		return di.parent.checkDependency(d)
+	}
+	return err
+}
+
+// checkOwnDependency checks if the dependency can be satisfied by the providers of this container
+func (di *PicoDI) checkOwnDependency(d dependency) error {
+	if d.name != "" {
+		_, err := di.findByName(d.name)
+		if errors.Is(err, ErrProviderNotFound) && strings.Contains(d.name, ".") {
+			_, _, err = di.findByPath(d.name)
+		}
+		return err
+	}
+	if et := factoryOf(d.typ); et != nil {
+		if _, ok := di.typeInjectors[d.typ]; !ok {
+			_, err := di.factoryProvider(et)
+			return err
+		}
+	}
+	if di.isCollection(d.typ) {
+		if _, ok := di.typeInjectors[d.typ]; !ok {
+			if di.isCollection(d.typ.Elem()) || len(di.collectable(d.typ)) > 0 {
+				return nil
+			}
+			return fmt.Errorf("%w for collection type %s", ErrProviderNotFound, d.typ)
+		}
+	}
+	_, err := di.findByType(d.typ)
+	if _, ok := di.missing[d.typ]; ok && errors.Is(err, ErrProviderNotFound) {
+		return nil
+	}
+	return err
+}
+
+// RegisterStrategy registers a provider only resolvable by the key, of a comparable type like an enum,
+// along with the provided type, eg: with ResolveStrategy[T].
+//
+//	di.RegisterStrategy(Fast, NewFastCompressor)
+func (di *PicoDI) RegisterStrategy(key interface{}, provider interface{}) error {
+	if key == nil || !reflect.TypeOf(key).Comparable() {
+		return fmt.Errorf("strategy key must be comparable: %#v", key)
+	}
+	return di.namedProvider("", provider, false, func(inj *injector) {
+		inj.strategy = key
+	})
+}
+
+// Module groups providers, to structure large applications, registered with Load()
+type Module struct {
+	// Name identifies the module in the errors
+	Name      string
+	Providers []interface{}
+	Named     map[string]interface{}
+}
+
+// Load registers the providers of all the modules, reporting all the failed registrations.
+// The named providers, of each module, are registered by name order.
+func (di *PicoDI) Load(modules ...Module) error {
+	failures := []string{}
+	for i, m := range modules {
+		name := m.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		for _, p := range m.Providers {
+			if err := di.namedProvider("", p, false); err != nil {
+				failures = append(failures, fmt.Sprintf("module %s: %s", name, err))
+			}
+		}
+		names := make([]string, 0, len(m.Named))
+		for k := range m.Named {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			if err := di.NamedProvider(k, m.Named[k]); err != nil {
+				failures = append(failures, fmt.Sprintf("module %s: provider %s: %s", name, k, err))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to load modules: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// NewScope creates a child container, where the providers not found are resolved by this container,
+// even if registered after the child was created.
+// The providers registered in the child take precedence, and their singletons are only shared inside the child.
+// A type is resolved, in order, by the child providers, by the child pointer/value fallbacks,
+// by this container, with the same rules, and lastly by the child OnMissing handlers.
+// The child inherits the configuration of this container at the time of creation, eg: options, wrappers, variables,
+// interface bindings and OnMissing handlers.
+// The aliases, the field resolvers, the collections and the injected factories also look up this container,
+// with the collections holding the providers of this container followed by the ones of the child.
+func (di *PicoDI) NewScope() *PicoDI {
+	child := New()
+	child.parent = di
+	child.logger = di.logger
+	child.typeKey = di.typeKey
+	child.nameResolver = di.nameResolver
+	child.strictUnexported = di.strictUnexported
+	child.eagerValidate = di.eagerValidate
+	child.pointerToValue = di.pointerToValue
+	child.valueFromPointer = di.valueFromPointer
+	child.mostDerived = di.mostDerived
+	child.fieldNames = di.fieldNames
+	child.underlyingMatch = di.underlyingMatch
+	child.asyncTimeout = di.asyncTimeout
+	child.trackTransients = di.trackTransients
+	child.collectStats = di.collectStats
+	child.autoClose = di.autoClose
+	child.transientDisposer = di.transientDisposer
+	child.wrappers = append(child.wrappers, di.wrappers...)
+	child.activeProfiles = append(child.activeProfiles, di.activeProfiles...)
+	for k, v := range di.keyTypes {
+		child.keyTypes[k] = v
+	}
+	for k, v := range di.vars {
+		child.vars[k] = v
+	}
+	for k, v := range di.bindings {
+		child.bindings[k] = v
+	}
+	for k, v := range di.selectors {
+		child.selectors[k] = v
+	}
+	for k, v := range di.missing {
+		child.missing[k] = v
+	}
+	return child
+}
+
+// Freeze locks the container against further registrations, that will fail with ErrContainerFrozen.
+// Resolution is not affected.
+func (di *PicoDI) Freeze() {
+	di.frozen = true
+}
+
+// outProviders registers every exported field of an Out struct as a provider,
+// sharing the construction of the struct
+func (di *PicoDI) outProviders(out *injector, options []ProviderOption) error {
+	for i := 0; i < out.typ.NumField(); i++ {
+		f := out.typ.Field(i)
+		if f.Anonymous && f.Type == outType || f.PkgPath != "" {
+			continue
+		}
+		idx := i
+		fn := func(ctx context.Context, dryRun bool) (interface{}, Clean, error) {
+			v, clean, err := di.get(ctx, out, false, dryRun)
+			if err != nil {
+				return nil, nil, err
+			}
+			return reflect.ValueOf(v).Field(idx).Interface(), clean, nil
+		}
+		// the dependencies of the field are the ones of the Out struct provider
+		inj := &injector{provider: fn, transient: out.transient, typ: f.Type, factory: out.factory}
+		for _, o := range options {
+			o(inj)
+		}
+		err := di.register(f.Tag.Get(outNameTagKey), inj)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+func (di *PicoDI) register(name string, inj *injector) error {
+	tn := inj.typ
+	inj.name = name
+	if inj.profile != "" {
+		for _, other := range di.profiled[inj.profile] {
+			if other.name == name && (name != "" || other.typ == tn) {
+				return fmt.Errorf("provider %s already registered for profile %s", inj.identifier(), inj.profile)
+			}
+		}
+		di.profiled[inj.profile] = append(di.profiled[inj.profile], inj)
+		// only resolvable while the profile is active, but always listed
+		di.order = append(di.order, inj)
+		di.logger.Debug("provider registered", "provider", inj.identifier(), "profile", inj.profile, "transient", inj.transient)
+		return nil
+	}
+	if inj.strategy != nil {
+		key := strategyKey{key: inj.strategy, typ: tn}
+		if _, ok := di.strategies[key]; ok {
+			return fmt.Errorf("strategy %v already registered for type %s", inj.strategy, tn)
+		}
+		di.strategies[key] = inj
+		// only resolvable by the strategy key, but always listed
+		di.order = append(di.order, inj)
+		di.logger.Debug("provider registered", "provider", inj.identifier(), "strategy", inj.strategy, "transient", inj.transient)
+		return nil
+	}
+	if inj.group != "" {
+		di.groups[inj.group] = append(di.groups[inj.group], inj)
+		di.logger.Debug("provider registered", "provider", inj.identifier(), "group", inj.group, "transient", inj.transient)
+		return nil
+	}
+	// all the checks are done before registering, so that a failure leaves no trace
 	if name != "" {
-		// name must be already registered
+		// name must not be already registered
 		v, ok := di.namedInjectors[name]
 		if ok {
 			return fmt.Errorf("name already registered for type %s", v.typ)
 		}
-		di.namedInjectors[name] = inj
-	} else {
+		if _, ok := di.forwards[name]; ok {
+			return fmt.Errorf("name already forwarded: %s", name)
+		}
+		if v, ok := di.typeKeys[name]; ok {
+			return fmt.Errorf("name %s collides with the type key of %s", name, v.typ)
+		}
+	}
+	byType := name == "" || inj.byType
+	key := di.typeKey(tn)
+	if byType {
 		_, ok := di.typeInjectors[tn]
 		if ok {
 			return fmt.Errorf("type already registered: %s", tn)
 		}
+		// an empty type key is not resolvable by name
+		if v, ok := di.typeKeys[key]; ok && key != "" {
+			return fmt.Errorf("type key %s of %s collides with the type key of %s", key, tn, v.typ)
+		}
+		if v, ok := di.namedInjectors[key]; ok && v != inj {
+			return fmt.Errorf("type key %s of %s collides with a provider name", key, tn)
+		}
+	}
+	if name != "" {
+		di.namedInjectors[name] = inj
+	}
+	if byType {
 		di.typeInjectors[tn] = inj
+		if key != "" {
+			di.typeKeys[key] = inj
+		}
 	}
+	di.order = append(di.order, inj)
+	di.logger.Debug("provider registered", "provider", inj.identifier(), "transient", inj.transient)
 
 	return nil
 }
 
 func validateProviderFunc(t reflect.Type) error {
 	// must return 1, 2 or 3 results
-	if t.NumOut() < 1 && t.NumOut() > 3 {
-		return fmt.Errorf("invalid provider function '%s'. Must return at least 1 value. Optionally can also return a clean function and/or error", t)
+	if t.NumOut() < 1 || t.NumOut() > 3 {
+		return fmt.Errorf("invalid provider function '%s'. Must return at least 1 value. Optionally can also return a clean function and/or error. For side effects only, consider AddInitializer", t)
 	}
 	// if we have 3 outputs, the last result must be an error
 	if t.NumOut() == 3 {
@@ -196,10 +879,17 @@ func validateProviderFunc(t reflect.Type) error {
 	return nil
 }
 
-func (di *PicoDI) funcInjection(provider reflect.Value, dryRun bool) (v interface{}, c Clean, err error) {
+func (di *PicoDI) funcInjection(ctx context.Context, provider reflect.Value, dryRun bool) (interface{}, Clean, error) {
+	return di.funcInjectionWith(ctx, provider, nil, dryRun)
+}
+
+// funcInjectionWith calls the provider function, resolving its arguments.
+// The arguments with a valid value in supplied, by position, are not resolved.
+func (di *PicoDI) funcInjectionWith(ctx context.Context, provider reflect.Value, supplied []reflect.Value, dryRun bool) (v interface{}, c Clean, err error) {
 	t := provider.Type()
 	argc := t.NumIn()
 	argv := make([]reflect.Value, argc)
+	var acquired *cleaner
 	var cleans []Clean
 	cleanDeps := func() {
 		for _, v := range cleans {
@@ -214,34 +904,29 @@ func (di *PicoDI) funcInjection(provider reflect.Value, dryRun bool) (v interfac
 		}
 	}()
 	for i := 0; i < argc; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
 		at := t.In(i)
-		if at.Kind() == reflect.Map && at.Key() == namedType {
-			valueType := at.Elem()
-			// create map
-			var aMapType = reflect.MapOf(namedType, valueType)
-			aMap := reflect.MakeMapWithSize(aMapType, 0)
-			// find all named type
-			for name, inj := range di.namedInjectors {
-				// implements an interface or it is of same type
-				if valueType.Kind() == reflect.Interface && inj.typ.Implements(valueType) || inj.typ == valueType {
-					v, clean, err := di.getByName(name, false, dryRun)
-					if err != nil {
-						return nil, nil, err
-					}
-					if clean != nil {
-						cleans = append(cleans, clean)
-					}
-
-					aMap.SetMapIndex(reflect.ValueOf(Named(name)), reflect.ValueOf(v))
-				}
+		if i < len(supplied) && supplied[i].IsValid() {
+			argv[i] = supplied[i]
+		} else if at == contextType {
+			argv[i] = reflect.ValueOf(ctx)
+		} else if at == cleanerType {
+			acquired = &cleaner{}
+			argv[i] = reflect.ValueOf(acquired)
+		} else if embedsType(at, inType) {
+			ptr := reflect.New(at)
+			clean, err := di.wireFields(ctx, ptr, dryRun)
+			if err != nil {
+				return nil, nil, err
 			}
-			if aMap.Len() == 0 {
-				return nil, nil, fmt.Errorf("no implementation was found for named type %s", t)
+			if clean != nil {
+				cleans = append(cleans, clean)
 			}
-
-			argv[i] = aMap
+			argv[i] = ptr.Elem()
 		} else {
-			arg, clean, err := di.getByType(at, false, dryRun)
+			arg, clean, err := di.getByType(ctx, at, false, dryRun)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -252,14 +937,26 @@ func (di *PicoDI) funcInjection(provider reflect.Value, dryRun bool) (v interfac
 		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
 	if dryRun {
 		if t.NumOut() == 0 {
 			return nil, nil, nil
 		}
-		return reflect.Zero(t.Out(0)).Interface(), nil, nil
+		return reflect.Zero(providedType(t.Out(0))).Interface(), nil, nil
 	}
 
 	results := provider.Call(argv)
+	if acquired != nil {
+		// the resources acquired by a failed provider are released
+		defer func() {
+			if err != nil {
+				acquired.clean()
+			}
+		}()
+	}
 
 	var clean Clean
 	clear := func() {
@@ -267,6 +964,9 @@ func (di *PicoDI) funcInjection(provider reflect.Value, dryRun bool) (v interfac
 		if clean != nil {
 			clean()
 		}
+		if acquired != nil {
+			acquired.clean()
+		}
 	}
 
 	// first wiring function
@@ -291,86 +991,1819 @@ func (di *PicoDI) funcInjection(provider reflect.Value, dryRun bool) (v interfac
 		}
 	}
 
+	if isAsync(t.Out(0)) {
+		value, err = di.await(ctx, results[0])
+		if err != nil {
+			if clean != nil {
+				clean()
+			}
+			return nil, nil, err
+		}
+	}
+
 	return value, clear, err
 }
 
-// GetByType returns the instance by Type
-func (di *PicoDI) GetByType(zero interface{}) (interface{}, Clean, error) {
-	t := reflect.TypeOf(zero)
-	return di.getByType(t, false, false)
+// returnsClean checks if the provider function returns a clean function
+func returnsClean(factory reflect.Value) bool {
+	if !factory.IsValid() {
+		return false
+	}
+	t := factory.Type()
+	return t.NumOut() > 1 && t.Out(1) == cleanType
 }
 
-// Resolve returns the instance by name
-func (di *PicoDI) Resolve(name string) (interface{}, Clean, error) {
-	return di.getByName(name, false, false)
+// isAsync checks if the type is a receive only channel, used by providers with an asynchronous initialization
+func isAsync(t reflect.Type) bool {
+	return t.Kind() == reflect.Chan && t.ChanDir() == reflect.RecvDir
 }
 
-func (di *PicoDI) getByName(name string, transient bool, dryRun bool) (interface{}, Clean, error) {
-	inj, ok := di.namedInjectors[name]
-	if !ok {
-		return nil, nil, fmt.Errorf("no provider was found for name '%s'", name)
+// providedType returns the type of the instances provided by a provider function returning t
+func providedType(t reflect.Type) reflect.Type {
+	if isAsync(t) {
+		return t.Elem()
 	}
-
-	return di.get(inj, transient, dryRun)
+	return t
 }
 
-func (di *PicoDI) getByType(t reflect.Type, transient bool, dryRun bool) (interface{}, Clean, error) {
-	if t.Kind() == reflect.Interface {
-		// collects all the instances that respect the interface
-		matches := []*injector{}
-		for _, v := range di.typeInjectors {
-			if v.typ.Implements(t) {
-				matches = append(matches, v)
-			}
-		}
-		if len(matches) == 1 {
-			return di.get(matches[0], transient, dryRun)
-		}
-		if len(matches) > 1 {
-			return nil, nil, fmt.Errorf("more than one implementation was found for interface type %s. Consider using named providers", t)
-		}
-		return nil, nil, fmt.Errorf("no implementation was found for interface type %s", t)
+// await blocks until a value is received from the channel, the context is done or the async timeout expires
+func (di *PicoDI) await(ctx context.Context, ch reflect.Value) (interface{}, error) {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+	if di.asyncTimeout > 0 {
+		timer := time.NewTimer(di.asyncTimeout)
+		defer timer.Stop()
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)})
 	}
 
-	inj, ok := di.typeInjectors[t]
-	if !ok {
-		return nil, nil, fmt.Errorf("no provider was found for type %s", t)
+	chosen, v, ok := reflect.Select(cases)
+	switch {
+	case chosen == 1:
+		return nil, ctx.Err()
+	case chosen == 2:
+		return nil, fmt.Errorf("timeout after %s waiting for value of type %s", di.asyncTimeout, ch.Type().Elem())
+	case !ok:
+		return nil, fmt.Errorf("channel of type %s was closed without a value", ch.Type())
 	}
+	return v.Interface(), nil
+}
 
-	return di.get(inj, transient, dryRun)
+// embedsType checks if the struct type t has an anonymous field of type marker
+func embedsType(t reflect.Type, marker reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type == marker {
+			return true
+		}
+	}
+	return false
 }
 
-func (di *PicoDI) get(inj *injector, transient bool, dryRun bool) (interface{}, Clean, error) {
-	if inj.transient || transient || dryRun {
-		return di.instantiateAndWire(inj, dryRun)
+// Explain reports, for each wired field of the struct pointed by value, including the fields of embedded structs,
+// the identifier of the provider that would satisfy it, following the same rules as Wire().
+// The identifier is the provider name or, if the provider is not named, its type name.
+// The fields resolved by a field resolver, collections, factories and the dependencies satisfied by a parent scope
+// are identified by their wire tag name or type name.
+// Like DryRun(), nothing is instantiated.
+func (di *PicoDI) Explain(value interface{}) (map[string]string, error) {
+	val := reflect.ValueOf(value)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("explain requires a pointer to a struct: %#v", value)
 	}
 
+	deps, err := di.structDependencies(val.Type())
+	if err != nil {
+		return nil, err
+	}
+	explained := map[string]string{}
+	for _, d := range deps {
+		if err := di.checkDependency(d); err != nil {
+			return nil, fmt.Errorf("unable to explain field '%s': %w", d.field, err)
+		}
+		explained[d.field] = di.explainDependency(d)
+	}
+
+	return explained, nil
+}
+
+// explainDependency returns the identifier of the provider of this container satisfying the dependency,
+// or the identifier of the dependency if it is not satisfied by a single provider of this container
+func (di *PicoDI) explainDependency(d dependency) string {
+	if d.resolved {
+		return d.identifier()
+	}
+	var inj *injector
+	var err error
+	if d.name != "" {
+		inj, err = di.findByName(d.name)
+	} else if _, provided := di.typeInjectors[d.typ]; provided || !di.isCollection(d.typ) && factoryOf(d.typ) == nil && !di.parentAlias(d.typ) {
+		inj, err = di.findByType(d.typ)
+	}
+	if inj == nil || err != nil {
+		return d.identifier()
+	}
+	return inj.identifier()
+}
+
+// ReportUnwired lists the exported fields, of the struct pointed by value, without the wire tag,
+// whose type could have been wired by a registered provider. It helps catching forgotten tags.
+func (di *PicoDI) ReportUnwired(value interface{}) []string {
+	t := reflect.TypeOf(value)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	t = t.Elem()
+	unwired := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if _, ok := f.Tag.Lookup(wireTagKey); ok || f.PkgPath != "" || f.Type == inType || f.Type == outType {
+			continue
+		}
+		if _, err := di.findByType(f.Type); err == nil {
+			unwired = append(unwired, f.Name)
+		}
+	}
+	return unwired
+}
+
+// BindInterface forces the interface to always be resolved by the provider registered for the type of zero,
+// regardless of other implementations.
+// The interface is passed as a pointer to the interface, eg:
+//
+//	di.BindInterface((*Namer)(nil), Foo{})
+func (di *PicoDI) BindInterface(iface interface{}, zero interface{}) error {
+	if di.frozen {
+		return ErrContainerFrozen
+	}
+	it, err := interfaceType(iface)
+	if err != nil {
+		return err
+	}
+	t := reflect.TypeOf(zero)
+	if t == nil || !t.Implements(it) {
+		return fmt.Errorf("type %s does not implement interface %s", t, it)
+	}
+	di.bindings[it] = t
+	return nil
+}
+
+// BindInterfaceFunc sets a selector to choose, at resolution time, the implementation of the interface
+// when more than one is found. The candidates are in registration order.
+// The interface is passed as a pointer to the interface, eg:
+//
+//	di.BindInterfaceFunc((*Namer)(nil), func(candidates []reflect.Type) reflect.Type {
+//		return candidates[0]
+//	})
+func (di *PicoDI) BindInterfaceFunc(iface interface{}, selector func(candidates []reflect.Type) reflect.Type) error {
+	if di.frozen {
+		return ErrContainerFrozen
+	}
+	it, err := interfaceType(iface)
+	if err != nil {
+		return err
+	}
+	di.selectors[it] = selector
+	return nil
+}
+
+// AliasType makes the alias type to be resolved by the provider already registered for the target type,
+// sharing the same instances. Interfaces are passed as a pointer to the interface, eg:
+//
+//	di.AliasType((*Greeter)(nil), &GreeterImpl{})
+func (di *PicoDI) AliasType(alias interface{}, target interface{}) error {
+	if di.frozen {
+		return ErrContainerFrozen
+	}
+	at := reflect.TypeOf(alias)
+	if it, err := interfaceType(alias); err == nil {
+		at = it
+	}
+	tt := reflect.TypeOf(target)
+	if at == nil || tt == nil {
+		return errors.New("alias and target types cannot be nil")
+	}
+	inj, ok := di.typeInjectors[tt]
+	if !ok {
+		return fmt.Errorf("%w for type %s", ErrProviderNotFound, tt)
+	}
+	if !tt.AssignableTo(at) {
+		return fmt.Errorf("type %s is not assignable to alias type %s", tt, at)
+	}
+	if _, ok := di.aliases[at]; ok {
+		return fmt.Errorf("alias already registered: %s", at)
+	}
+	di.aliases[at] = inj
+	return nil
+}
+
+// interfaceType returns the interface type from a pointer to an interface, eg: (*fmt.Stringer)(nil)
+func interfaceType(iface interface{}) (reflect.Type, error) {
+	t := reflect.TypeOf(iface)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Interface {
+		return nil, fmt.Errorf("expected a pointer to an interface, eg: (*fmt.Stringer)(nil), got %s", t)
+	}
+	return t.Elem(), nil
+}
+
+// DependenciesOf returns the identifiers of the dependencies of the named provider,
+// collected from the arguments of the provider function and from the wiring tags of the provided struct.
+// A dependency resolved by type is identified by its type name.
+func (di *PicoDI) DependenciesOf(name string) ([]string, error) {
+	inj, err := di.findByName(name)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := di.dependencies(inj)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(deps))
+	for _, d := range deps {
+		if !d.resolved {
+			ids = append(ids, d.identifier())
+		}
+	}
+	return ids, nil
+}
+
+// dependency is a dependency, by name or by type, declared by a provider or a wiring target
+type dependency struct {
+	// name is empty if the dependency is by type
+	name string
+	typ  reflect.Type
+	// field is the struct field declaring the dependency, if any
+	field string
+	// resolved is set for the fields resolved by a field resolver, instead of by a provider
+	resolved bool
+}
+
+// strategyKey identifies a provider registered with RegisterStrategy
+type strategyKey struct {
+	key interface{}
+	typ reflect.Type
+}
+
+// findStrategy finds the provider registered for the key and the type t.
+// If t is an interface, the provider for the key that respects it is also accepted.
+func (di *PicoDI) findStrategy(key interface{}, t reflect.Type) (*injector, error) {
+	if key == nil || !reflect.TypeOf(key).Comparable() {
+		return nil, fmt.Errorf("strategy key must be comparable: %#v", key)
+	}
+	if inj, ok := di.strategies[strategyKey{key: key, typ: t}]; ok {
+		return inj, nil
+	}
+	matches := []*injector{}
+	if t.Kind() == reflect.Interface {
+		for k, inj := range di.strategies {
+			if k.key == key && inj.satisfies(t) {
+				matches = append(matches, inj)
+			}
+		}
+	}
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("%w for strategy %v and interface type %s: %v", ErrMultipleProvidersFound, key, t, injectorTypes(matches))
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w for strategy %v and type %s", ErrProviderNotFound, key, t)
+	}
+	return matches[0], nil
+}
+
+// pendingDependency is a dependency, of a provider, that was missing on registration
+type pendingDependency struct {
+	provider   string
+	dependency dependency
+}
+
+func (d dependency) identifier() string {
+	if d.name != "" {
+		return d.name
+	}
+	return d.typ.String()
+}
+
+func (di *PicoDI) dependencies(inj *injector) ([]dependency, error) {
+	deps := []dependency{}
+	if inj.factory.IsValid() {
+		d, err := di.funcDependencies(inj.factory.Type())
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, d...)
+	}
+
+	d, err := di.structDependencies(inj.typ)
+	if err != nil {
+		return nil, err
+	}
+	return append(deps, d...), nil
+}
+
+// funcDependencies returns the dependencies from the arguments of a function type
+func (di *PicoDI) funcDependencies(ft reflect.Type) ([]dependency, error) {
+	deps := []dependency{}
+	for i := 0; i < ft.NumIn(); i++ {
+		at := ft.In(i)
+		if at == contextType || at == cleanerType {
+			// supplied by the resolution
+			continue
+		}
+		if embedsType(at, inType) {
+			d, err := di.structDependencies(at)
+			if err != nil {
+				return nil, err
+			}
+			deps = append(deps, d...)
+			continue
+		}
+		deps = append(deps, dependency{typ: at})
+	}
+	return deps, nil
+}
+
+// structDependencies returns the dependencies from the tagged fields of a struct, or pointer to struct, type
+func (di *PicoDI) structDependencies(t reflect.Type) ([]dependency, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	deps := []dependency{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup(wireTagKey)
+		if !ok {
+			if f.Anonymous {
+				d, err := di.structDependencies(f.Type)
+				if err != nil {
+					return nil, err
+				}
+				deps = append(deps, d...)
+			}
+			continue
+		}
+		wt, err := di.fieldWireTag(f, tag)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := di.fieldResolver(wt.name); ok {
+			deps = append(deps, dependency{name: wt.name, typ: f.Type, field: f.Name, resolved: true})
+			continue
+		}
+		name := wt.name
+		if name == "" {
+			name = di.nameFromField(f)
+		}
+		deps = append(deps, dependency{name: name, typ: f.Type, field: f.Name})
+	}
+	return deps, nil
+}
+
+// ambiguities walks the dependency graph, from the dependencies deps, collecting the interface types
+// resolved by type that have more than one implementation.
+func (di *PicoDI) ambiguities(deps []dependency, visited map[*injector]bool) []string {
+	found := []string{}
+	for _, d := range deps {
+		if d.resolved {
+			continue
+		}
+		if d.name == "" && di.isCollection(d.typ) {
+			if _, ok := di.typeInjectors[d.typ]; !ok {
+				for _, inj := range di.collectable(d.typ) {
+					found = append(found, di.ambiguities([]dependency{{name: inj.name, typ: inj.typ}}, visited)...)
+				}
+				continue
+			}
+		}
+		var inj *injector
+		profile, profiled := di.profileMatches(func(inj *injector) bool { return inj.name == "" && inj.satisfies(d.typ) })
+		if d.name != "" {
+			inj, _ = di.findByName(d.name)
+		} else if len(profiled) > 1 {
+			found = append(found, fmt.Sprintf("type %s has implementations %v in profile %s", d.typ, injectorTypes(profiled), profile))
+			continue
+		} else if d.typ.Kind() == reflect.Interface && !di.isBound(d.typ) && len(profiled) == 0 {
+			matches := di.interfaceMatches(d.typ)
+			if len(matches) > 1 && di.mostDerived {
+				if inj := mostDerived(matches); inj != nil {
+					matches = []*injector{inj}
+				}
+			}
+			if len(matches) > 1 {
+				found = append(found, fmt.Sprintf("interface type %s has implementations %v", d.typ, injectorTypes(matches)))
+				continue
+			}
+			if len(matches) == 1 {
+				inj = matches[0]
+			}
+		} else {
+			inj, _ = di.findByType(d.typ)
+		}
+		if inj == nil || visited[inj] {
+			continue
+		}
+		visited[inj] = true
+		next, err := di.dependencies(inj)
+		if err != nil {
+			// errors are reported by the resolution
+			continue
+		}
+		found = append(found, di.ambiguities(next, visited)...)
+	}
+	return found
+}
+
+// isCollection checks if the type is a slice or a map keyed by a named key, to be collected from many providers
+func (di *PicoDI) isCollection(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice || t.Kind() == reflect.Map && di.isNamedKey(t.Key())
+}
+
+// isNamedKey checks if the map key type is Named or one of the key types registered with WithMapKeyTypes
+func (di *PicoDI) isNamedKey(t reflect.Type) bool {
+	return t == namedType || di.keyTypes[t]
+}
+
+// collectable returns the providers, in registration order, that would be collected into the collection type t.
+// Maps only collect named providers and nested maps only the ones with a two level name, eg: "http.auth".
+func (di *PicoDI) collectable(t reflect.Type) []*injector {
+	elemType := t.Elem()
+	nested := t.Kind() == reflect.Map && elemType.Kind() == reflect.Map && di.isNamedKey(elemType.Key())
+	if nested {
+		elemType = elemType.Elem()
+	}
+	injs := []*injector{}
+	// a provider discoverable by name and by type is only once in the registration order, so it is collected once
+	for _, inj := range di.order {
+		if t.Kind() == reflect.Map && inj.name == "" || inj.excluded || !di.resolvable(inj) {
+			continue
+		}
+		if nested && !strings.Contains(inj.name, ".") {
+			continue
+		}
+		if inj.satisfies(elemType) {
+			injs = append(injs, inj)
+		}
+	}
+	return injs
+}
+
+// isBound checks if the interface type has an explicit resolution, by alias, binding, selector or provider registered for the interface
+func (di *PicoDI) isBound(t reflect.Type) bool {
+	_, alias := di.aliases[t]
+	_, binding := di.bindings[t]
+	_, selector := di.selectors[t]
+	_, provided := di.typeInjectors[t]
+	return alias || binding || selector || provided
+}
+
+// parentAlias checks if the type, not aliased by this container, is aliased by one of the parent containers
+func (di *PicoDI) parentAlias(t reflect.Type) bool {
+	if _, ok := di.aliases[t]; ok {
+		return false
+	}
+	for p := di.parent; p != nil; p = p.parent {
+		if _, ok := p.aliases[t]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func injectorTypes(injs []*injector) []reflect.Type {
+	types := make([]reflect.Type, len(injs))
+	for i, inj := range injs {
+		types[i] = inj.typ
+	}
+	return types
+}
+
+// SetLogger sets the logger. By default nothing is logged.
+func (di *PicoDI) SetLogger(l Logger) {
+	di.logger = l
+}
+
+// SetNameResolver sets the function used to compute the provider name of the fields tagged with the flag `named`, eg: `wire:",named"`
+func (di *PicoDI) SetNameResolver(fn func(field reflect.StructField) string) {
+	di.nameResolver = fn
+}
+
+// WrapProvider adds a middleware around every provider invocation, eg: for timing or tracing the construction of the instances.
+// The middlewares are called in the order they were added.
+//
+//	di.WrapProvider(func(next picodi.ProviderInvocation) picodi.ProviderInvocation {
+//		return func(id string) (interface{}, picodi.Clean, error) {
+//			start := time.Now()
+//			defer func() { log.Println(id, time.Since(start)) }()
+//			return next(id)
+//		}
+//	})
+func (di *PicoDI) WrapProvider(fn func(next ProviderInvocation) ProviderInvocation) {
+	di.wrappers = append(di.wrappers, fn)
+}
+
+// SetTransientDisposer sets the function that receives every transient instance produced, with its clean function,
+// eg: to register the clean in a request scoped cleanup stack. The clean is still returned to the caller.
+func (di *PicoDI) SetTransientDisposer(fn func(instance interface{}, clean Clean)) {
+	di.transientDisposer = fn
+}
+
+// Resolver is a read-only view of the container, that can only resolve instances.
+// It can also be used with the generic helpers, eg: picodi.GetByType[Foo](resolver)
+type Resolver interface {
+	// Resolve returns the instance by name
+	Resolve(name string) (interface{}, Clean, error)
+	// GetByType returns the instance by Type
+	GetByType(zero interface{}) (interface{}, Clean, error)
+
+	container() *PicoDI
+}
+
+type readOnly struct {
+	di *PicoDI
+}
+
+func (r readOnly) Resolve(name string) (interface{}, Clean, error) {
+	return r.di.Resolve(name)
+}
+
+func (r readOnly) GetByType(zero interface{}) (interface{}, Clean, error) {
+	return r.di.GetByType(zero)
+}
+
+func (r readOnly) container() *PicoDI {
+	return r.di
+}
+
+// ReadOnly returns a view of the container that can resolve, sharing the same instances, but not register.
+// This is useful to pass the container to plugins.
+func (di *PicoDI) ReadOnly() Resolver {
+	return readOnly{di}
+}
+
+func (di *PicoDI) container() *PicoDI {
+	return di
+}
+
+// GetByType returns the instance by Type.
+// Interfaces are resolved with a typed nil pointer to the interface, eg: di.GetByType((*Greeter)(nil)),
+// unless there is a provider for the pointer to the interface.
+func (di *PicoDI) GetByType(zero interface{}) (interface{}, Clean, error) {
+	t := reflect.TypeOf(zero)
+	if t == nil {
+		return nil, nil, errors.New("cannot get by the type of an untyped nil, eg: use (*Greeter)(nil) for interfaces")
+	}
+	if _, ok := di.typeInjectors[t]; !ok {
+		if it, err := interfaceType(zero); err == nil {
+			t = it
+		}
+	}
+	return di.getByType(context.Background(), t, false, false)
+}
+
+// Resolve returns the instance by name
+func (di *PicoDI) Resolve(name string) (interface{}, Clean, error) {
+	return di.getByName(context.Background(), name, false, false)
+}
+
+// ProviderMeta is the registration metadata of a provider
+type ProviderMeta struct {
+	// Name is empty if the provider is registered by type
+	Name      string
+	Type      reflect.Type
+	Transient bool
+	Labels    []string
+}
+
+// ResolveWithMeta returns the instance by name, along with the metadata of its provider and the clean function, like Resolve()
+func (di *PicoDI) ResolveWithMeta(name string) (interface{}, ProviderMeta, Clean, error) {
+	inj, err := di.findByName(name)
+	if err != nil {
+		return nil, ProviderMeta{}, nil, err
+	}
+	v, clean, err := di.get(context.Background(), inj, false, false)
+	if err != nil {
+		return nil, ProviderMeta{}, nil, err
+	}
+	return v, inj.meta(), clean, nil
+}
+
+// EachNamed calls fn for each named provider, in registration order, stopping at the first error
+func (di *PicoDI) EachNamed(fn func(name string, meta ProviderMeta) error) error {
+	for _, inj := range di.order {
+		if inj.name == "" {
+			continue
+		}
+		if err := fn(inj.name, inj.meta()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (di *PicoDI) getByName(ctx context.Context, name string, transient bool, dryRun bool) (interface{}, Clean, error) {
+	inj, err := di.findByName(name)
+	if errors.Is(err, ErrProviderNotFound) && strings.Contains(name, ".") {
+		v, clean, err := di.getByPath(ctx, name, transient, dryRun)
+		if !errors.Is(err, ErrProviderNotFound) || di.parent == nil {
+			return v, clean, err
+		}
+	}
+	if errors.Is(err, ErrProviderNotFound) && di.parent != nil {
+		return di.parent.getByName(ctx, name, transient, dryRun)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return di.get(ctx, inj, transient, dryRun)
+}
+
+// getByPath returns the value of the field, of the instance of a named provider, referenced by the path,
+// eg: "config.DB.Timeout" is the field DB.Timeout of the provider "config".
+func (di *PicoDI) getByPath(ctx context.Context, path string, transient bool, dryRun bool) (interface{}, Clean, error) {
+	inj, fields, err := di.findByPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, clean, err := di.get(ctx, inj, transient, dryRun)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	val := valueOf(v, inj.typ)
+	for _, f := range fields {
+		for val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				val = reflect.Zero(val.Type().Elem())
+			} else {
+				val = val.Elem()
+			}
+		}
+		val = val.FieldByIndex(f.Index)
+	}
+	return val.Interface(), clean, nil
+}
+
+// findByPath finds the named provider with the longest name that prefixes the path, returning the fields referenced by the remaining path
+func (di *PicoDI) findByPath(path string) (*injector, []reflect.StructField, error) {
+	for idx := strings.LastIndex(path, "."); idx > 0; idx = strings.LastIndex(path[:idx], ".") {
+		inj, err := di.findByName(path[:idx])
+		if err != nil {
+			continue
+		}
+		fields := []reflect.StructField{}
+		t := inj.typ
+		for _, name := range strings.Split(path[idx+1:], ".") {
+			for t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			var f reflect.StructField
+			ok := false
+			if t.Kind() == reflect.Struct {
+				f, ok = t.FieldByName(name)
+			}
+			if !ok || f.PkgPath != "" {
+				return nil, nil, fmt.Errorf("%w for path '%s': no exported field '%s' in type %s", ErrProviderNotFound, path, name, t)
+			}
+			fields = append(fields, f)
+			t = f.Type
+		}
+		return inj, fields, nil
+	}
+	return nil, nil, fmt.Errorf("%w for name '%s'", ErrProviderNotFound, path)
+}
+
+// SetActiveProfiles sets the profiles whose providers can be resolved, taking precedence over the providers without profile.
+// The first profile has the highest precedence.
+func (di *PicoDI) SetActiveProfiles(profiles ...string) {
+	di.activeProfiles = profiles
+}
+
+// resolvable checks if the provider can be found by name, by type or collected,
+// excluding the providers only resolvable by the strategy key and the ones of inactive profiles
+func (di *PicoDI) resolvable(inj *injector) bool {
+	return inj.strategy == nil && !di.inactive(inj)
+}
+
+// inactive checks if the provider belongs to a profile that is not active
+func (di *PicoDI) inactive(inj *injector) bool {
+	if inj.profile == "" {
+		return false
+	}
+	for _, p := range di.activeProfiles {
+		if p == inj.profile {
+			return false
+		}
+	}
+	return true
+}
+
+// profileMatches returns the providers that match, of the first active profile with any match
+func (di *PicoDI) profileMatches(match func(inj *injector) bool) (string, []*injector) {
+	for _, p := range di.activeProfiles {
+		matches := []*injector{}
+		for _, inj := range di.profiled[p] {
+			if match(inj) {
+				matches = append(matches, inj)
+			}
+		}
+		if len(matches) > 0 {
+			return p, matches
+		}
+	}
+	return "", nil
+}
+
+// findInProfiles returns the provider, of the first active profile with a match, that matches.
+// It returns nil if there is no match, and ErrMultipleProvidersFound if there is more than one match in the same profile.
+func (di *PicoDI) findInProfiles(match func(inj *injector) bool) (*injector, error) {
+	profile, matches := di.profileMatches(match)
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("%w in profile %s: %v. Consider using named providers", ErrMultipleProvidersFound, profile, injectorTypes(matches))
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	return nil, nil
+}
+
+func (di *PicoDI) findByName(name string) (*injector, error) {
+	if target, ok := di.forwards[name]; ok {
+		return di.findByName(target)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%w for an empty name", ErrProviderNotFound)
+	}
+	inj, err := di.findInProfiles(func(inj *injector) bool {
+		return inj.name == name || inj.name == "" && di.typeKey(inj.typ) == name
+	})
+	if err != nil {
+		return nil, err
+	}
+	if inj == nil {
+		inj = di.namedInjectors[name]
+	}
+	ok := inj != nil
+	if ok && inj.disabled {
+		return nil, fmt.Errorf("%w for name '%s': the provider is disabled", ErrProviderNotFound, name)
+	}
+	if ok {
+		return inj, nil
+	}
+	// providers registered by type can also be resolved by their type key
+	if inj, ok := di.typeKeys[name]; ok {
+		return inj, nil
+	}
+	return nil, fmt.Errorf("%w for name '%s'", ErrProviderNotFound, name)
+}
+
+// hasName checks if there is a provider for the name, or for the path of the name, in this container or in the parents
+func (di *PicoDI) hasName(name string) bool {
+	if _, err := di.findByName(name); err == nil {
+		return true
+	}
+	if strings.Contains(name, ".") {
+		if _, _, err := di.findByPath(name); err == nil {
+			return true
+		}
+	}
+	return di.parent != nil && di.parent.hasName(name)
+}
+
+// defaultTypeKey returns the full type name, eg: `github.com/quintans/picodi/Foo`,
+// or the type string representation for unnamed types, eg: `*picodi.Foo`
+func defaultTypeKey(t reflect.Type) string {
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "/" + t.Name()
+	}
+	return t.String()
+}
+
+func (di *PicoDI) getByType(ctx context.Context, t reflect.Type, transient bool, dryRun bool) (interface{}, Clean, error) {
+	if t.Kind() == reflect.Slice {
+		// a provider of the exact slice type takes precedence over the collection
+		if _, ok := di.typeInjectors[t]; !ok {
+			return di.collect(ctx, t, transient, dryRun)
+		}
+	}
+	if t.Kind() == reflect.Map && di.isNamedKey(t.Key()) {
+		// a provider of the exact map type takes precedence over the collection
+		if _, ok := di.typeInjectors[t]; !ok {
+			var cleans []Clean
+			cleanDeps := func() {
+				for _, v := range cleans {
+					v()
+				}
+				cleans = nil
+			}
+			aMap, err := di.collectNamed(ctx, t, dryRun, &cleans)
+			if err != nil {
+				cleanDeps()
+				return nil, nil, err
+			}
+			return aMap.Interface(), cleanDeps, nil
+		}
+	}
+	if et := factoryOf(t); et != nil {
+		// a provider of the exact function type takes precedence over the factory
+		if _, ok := di.typeInjectors[t]; !ok {
+			v, clean, err := di.factoryFor(ctx, t, et, dryRun)
+			if errors.Is(err, ErrProviderNotFound) && di.parent != nil {
+				return di.parent.getByType(ctx, t, transient, dryRun)
+			}
+			return v, clean, err
+		}
+	}
+	if di.parentAlias(t) {
+		// resolved by the parent, where the alias was declared
+		return di.parent.getByType(ctx, t, transient, dryRun)
+	}
+
+	inj, err := di.findByType(t)
+	if errors.Is(err, ErrProviderNotFound) && di.pointerToValue && t.Kind() == reflect.Ptr && t.Elem().Kind() != reflect.Interface {
+		var v interface{}
+		var clean Clean
+		v, clean, err = di.getAddressOf(ctx, t.Elem(), transient, dryRun)
+		if !errors.Is(err, ErrProviderNotFound) {
+			return v, clean, err
+		}
+	}
+	if errors.Is(err, ErrProviderNotFound) && di.valueFromPointer && t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface {
+		var v interface{}
+		var clean Clean
+		v, clean, err = di.getPointedBy(ctx, t, transient, dryRun)
+		if !errors.Is(err, ErrProviderNotFound) {
+			return v, clean, err
+		}
+	}
+	if errors.Is(err, ErrProviderNotFound) && di.parent != nil {
+		// the parent providers are looked up at resolution time
+		v, clean, err := di.parent.getByType(ctx, t, transient, dryRun)
+		if err != nil {
+			return di.resolveMissing(t, err, dryRun)
+		}
+		return v, clean, nil
+	}
+	if err != nil {
+		return di.resolveMissing(t, err, dryRun)
+	}
+
+	v, clean, err := di.get(ctx, inj, transient, dryRun)
+	return di.coerce(v, t), clean, err
+}
+
+// factoryOf returns T if t is a factory function type, `func() (T, error)`, otherwise nil
+func factoryOf(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Func && t.NumIn() == 0 && t.NumOut() == 2 && t.Out(1) == errorType {
+		return t.Out(0)
+	}
+	return nil
+}
+
+// factoryProvider returns the provider of the instances created by a factory function, that must be transient
+func (di *PicoDI) factoryProvider(et reflect.Type) (*injector, error) {
+	inj, err := di.findByType(et)
+	if err != nil {
+		return nil, err
+	}
+	if !inj.transient {
+		return nil, fmt.Errorf("the factory of %s requires a transient provider, but %s is a singleton", et, inj.identifier())
+	}
+	return inj, nil
+}
+
+// factoryFor returns a function, of the factory type t, that returns a new instance of the transient provider of et on every call.
+// The clean functions of the instances are only called by Destroy with the option WithTransientTracking,
+// since they cannot be returned by the factory, or by a transient disposer.
+func (di *PicoDI) factoryFor(ctx context.Context, t reflect.Type, et reflect.Type, dryRun bool) (interface{}, Clean, error) {
+	// fails on injection, instead of on the first call, if et cannot be resolved
+	inj, err := di.factoryProvider(et)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, _, err := di.get(ctx, inj, false, true); err != nil {
+		return nil, nil, err
+	}
+	if dryRun {
+		return reflect.Zero(t).Interface(), nil, nil
+	}
+	fn := reflect.MakeFunc(t, func([]reflect.Value) []reflect.Value {
+		v, _, err := di.get(context.Background(), inj, false, false)
+		// the results must be of the exact types of the function
+		instance, errValue := reflect.New(et).Elem(), reflect.New(errorType).Elem()
+		if err != nil {
+			errValue.Set(reflect.ValueOf(err))
+		} else if v != nil {
+			instance.Set(reflect.ValueOf(v))
+		}
+		return []reflect.Value{instance, errValue}
+	})
+	return fn.Interface(), nil, nil
+}
+
+// getPointedBy returns a copy of the value pointed by the instance of the provider of the pointer type to t
+func (di *PicoDI) getPointedBy(ctx context.Context, t reflect.Type, transient bool, dryRun bool) (interface{}, Clean, error) {
+	pt := reflect.PtrTo(t)
+	if _, err := di.findByType(pt); err != nil {
+		// report the requested type
+		return nil, nil, fmt.Errorf("%w for type %s or %s", ErrProviderNotFound, t, pt)
+	}
+	v, clean, err := di.getByType(ctx, pt, transient, dryRun)
+	if err != nil {
+		return nil, nil, err
+	}
+	ptr := reflect.ValueOf(v)
+	if ptr.IsNil() {
+		return reflect.Zero(t).Interface(), clean, nil
+	}
+	return ptr.Elem().Interface(), clean, nil
+}
+
+// getAddressOf returns a pointer to the instance of the provider of the value type t.
+// For singletons, the pointer is always the same, to a copy of the cached instance.
+func (di *PicoDI) getAddressOf(ctx context.Context, t reflect.Type, transient bool, dryRun bool) (interface{}, Clean, error) {
+	inj, err := di.findByType(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, clean, err := di.get(ctx, inj, transient, dryRun)
+	if err != nil {
+		return nil, nil, err
+	}
+	if inj.transient || transient || dryRun || inj.contextual != nil || !inj.addr.IsValid() {
+		ptr := reflect.New(t)
+		ptr.Elem().Set(valueOf(v, t))
+		if inj.transient || transient || dryRun || inj.contextual != nil {
+			return ptr.Interface(), clean, nil
+		}
+		inj.addr = ptr
+	}
+	return inj.addr.Interface(), clean, nil
+}
+
+// collect returns a slice, of type t, with all the providers, named or not, that satisfy the slice element type.
+// The slice elements are in registration order.
+func (di *PicoDI) collect(ctx context.Context, t reflect.Type, transient bool, dryRun bool) (v interface{}, c Clean, err error) {
+	elemType := t.Elem()
+	var cleans []Clean
+	cleanDeps := func() {
+		for _, v := range cleans {
+			v()
+		}
+		cleans = nil
+	}
+
+	defer func() {
+		if err != nil {
+			cleanDeps()
+		}
+	}()
+
+	slice := reflect.MakeSlice(t, 0, 0)
+	if di.parent != nil {
+		// the parent providers are collected first
+		v, clean, err := di.parent.collect(ctx, t, transient, dryRun)
+		if err != nil && !errors.Is(err, ErrProviderNotFound) {
+			return nil, nil, err
+		}
+		if err == nil {
+			if clean != nil {
+				cleans = append(cleans, clean)
+			}
+			slice = reflect.AppendSlice(slice, reflect.ValueOf(v))
+		}
+	}
+	for _, inj := range di.collectable(t) {
+		v, clean, err := di.get(ctx, inj, transient, dryRun)
+		if err != nil {
+			return nil, nil, err
+		}
+		if clean != nil {
+			cleans = append(cleans, clean)
+		}
+		slice = reflect.Append(slice, valueOf(v, elemType))
+	}
+	if slice.Len() == 0 {
+		return nil, nil, fmt.Errorf("no implementation was found for slice type %s: %w", t, ErrProviderNotFound)
+	}
+	if !dryRun {
+		sortByOrder(slice)
+	}
+
+	return slice.Interface(), cleanDeps, nil
+}
+
+// collectNamed returns a map, of type t with a named key, eg: Named, with all the named providers that satisfy the map value type.
+// If the map value type is also a map keyed by Named, the provider names are split by the first '.' into the keys of the two levels,
+// eg: the provider named "http.auth" is collected into m["http"]["auth"].
+func (di *PicoDI) collectNamed(ctx context.Context, t reflect.Type, dryRun bool, cleans *[]Clean) (reflect.Value, error) {
+	valueType := t.Elem()
+	nested := valueType.Kind() == reflect.Map && di.isNamedKey(valueType.Key())
+	aMap := reflect.MakeMapWithSize(t, 0)
+	if di.parent != nil {
+		// the parent providers are collected first, being replaced by the child providers with the same name
+		parentMap, err := di.parent.collectNamed(ctx, t, dryRun, cleans)
+		if err != nil && !errors.Is(err, ErrProviderNotFound) {
+			return reflect.Value{}, err
+		}
+		if err == nil {
+			aMap = parentMap
+		}
+	}
+	for _, inj := range di.collectable(t) {
+		v, clean, err := di.get(ctx, inj, false, dryRun)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if clean != nil {
+			*cleans = append(*cleans, clean)
+		}
+
+		if !nested {
+			aMap.SetMapIndex(reflect.ValueOf(inj.name).Convert(t.Key()), valueOf(v, valueType))
+			continue
+		}
+		outer, inner, _ := strings.Cut(inj.name, ".")
+		key := reflect.ValueOf(outer).Convert(t.Key())
+		innerMap := aMap.MapIndex(key)
+		if !innerMap.IsValid() {
+			innerMap = reflect.MakeMapWithSize(valueType, 0)
+			aMap.SetMapIndex(key, innerMap)
+		}
+		innerMap.SetMapIndex(reflect.ValueOf(inner).Convert(valueType.Key()), valueOf(v, valueType.Elem()))
+	}
+	if aMap.Len() == 0 {
+		return reflect.Value{}, fmt.Errorf("no implementation was found for named type %s: %w", t, ErrProviderNotFound)
+	}
+
+	return aMap, nil
+}
+
+// sortByOrder sorts, preserving the registration order for equal values, the slice elements by the value of Order(), if they implement Ordered.
+// Elements not implementing Ordered have order zero.
+func sortByOrder(slice reflect.Value) {
+	order := func(i int) int {
+		e := slice.Index(i)
+		if (e.Kind() == reflect.Ptr || e.Kind() == reflect.Interface) && e.IsNil() {
+			return 0
+		}
+		if o, ok := e.Interface().(Ordered); ok {
+			return o.Order()
+		}
+		return 0
+	}
+	orders := make([]int, slice.Len())
+	for i := range orders {
+		orders[i] = order(i)
+	}
+	swap := reflect.Swapper(slice.Interface())
+	sort.Stable(orderSorter{orders, swap})
+}
+
+type orderSorter struct {
+	orders []int
+	swap   func(i, j int)
+}
+
+func (s orderSorter) Len() int           { return len(s.orders) }
+func (s orderSorter) Less(i, j int) bool { return s.orders[i] < s.orders[j] }
+func (s orderSorter) Swap(i, j int) {
+	s.orders[i], s.orders[j] = s.orders[j], s.orders[i]
+	s.swap(i, j)
+}
+
+func (di *PicoDI) findByType(t reflect.Type) (*injector, error) {
+	if inj, ok := di.aliases[t]; ok {
+		return inj, nil
+	}
+	inj, err := di.findInProfiles(func(inj *injector) bool { return inj.name == "" && inj.satisfies(t) })
+	if err != nil || inj != nil {
+		return inj, err
+	}
+	if t.Kind() == reflect.Interface {
+		// registered for the interface, eg: with ProvideInterface
+		if inj, ok := di.typeInjectors[t]; ok {
+			return inj, nil
+		}
+		if bound, ok := di.bindings[t]; ok {
+			inj, ok := di.typeInjectors[bound]
+			if !ok {
+				return nil, fmt.Errorf("%w for type %s bound to interface %s", ErrProviderNotFound, bound, t)
+			}
+			return inj, nil
+		}
+		matches := di.interfaceMatches(t)
+		if len(matches) == 1 {
+			return matches[0], nil
+		}
+		// an explicit selector takes precedence over the global most derived rule
+		if selector, ok := di.selectors[t]; ok && len(matches) > 1 {
+			return selectCandidate(t, matches, selector)
+		}
+		if di.mostDerived && len(matches) > 1 {
+			if inj := mostDerived(matches); inj != nil {
+				return inj, nil
+			}
+		}
+		if len(matches) > 1 {
+			return nil, fmt.Errorf("%w for interface type %s: %v. Consider using named providers", ErrMultipleProvidersFound, t, injectorTypes(matches))
+		}
+		return nil, fmt.Errorf("no implementation was found for interface type %s: %w", t, ErrProviderNotFound)
+	}
+
+	inj, ok := di.typeInjectors[t]
+	if !ok && di.underlyingMatch {
+		return di.findConvertible(t)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w for type %s", ErrProviderNotFound, t)
+	}
+	return inj, nil
+}
+
+// findConvertible finds the provider, registered by type, of the same kind that is convertible to t, eg: `string` to `Message`
+func (di *PicoDI) findConvertible(t reflect.Type) (*injector, error) {
+	matches := []*injector{}
+	for _, inj := range di.order {
+		if inj.name == "" && di.resolvable(inj) && inj.typ.Kind() == t.Kind() && inj.typ.ConvertibleTo(t) {
+			matches = append(matches, inj)
+		}
+	}
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("%w convertible to type %s: %v", ErrMultipleProvidersFound, t, injectorTypes(matches))
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w for type %s", ErrProviderNotFound, t)
+	}
+	return matches[0], nil
+}
+
+// coerce converts v to the type t, if underlying matching is enabled and v is not assignable to t
+func (di *PicoDI) coerce(v interface{}, t reflect.Type) interface{} {
+	if !di.underlyingMatch || v == nil {
+		return v
+	}
+	vt := reflect.TypeOf(v)
+	if vt.AssignableTo(t) || vt.Kind() != t.Kind() || !vt.ConvertibleTo(t) {
+		return v
+	}
+	return reflect.ValueOf(v).Convert(t).Interface()
+}
+
+// interfaceMatches collects all the providers, registered by type, that respect the interface.
+// If there are none, the named providers that respect the interface are collected,
+// and if there are still none, the ones excluded from collection.
+func (di *PicoDI) interfaceMatches(t reflect.Type) []*injector {
+	matches := []*injector{}
+	named := []*injector{}
+	excluded := []*injector{}
+	for _, v := range di.order {
+		if !v.typ.Implements(t) || !di.resolvable(v) {
+			continue
+		}
+		if v.excluded {
+			excluded = append(excluded, v)
+		} else if v.name == "" {
+			matches = append(matches, v)
+		} else {
+			named = append(named, v)
+		}
+	}
+	if len(matches) == 0 && len(named) == 0 {
+		return excluded
+	}
+	if len(matches) == 0 {
+		return named
+	}
+	return matches
+}
+
+// mostDerived returns the match that embeds all the other matches, directly or indirectly, or nil if there is none
+func mostDerived(matches []*injector) *injector {
+	for _, m := range matches {
+		all := true
+		for _, o := range matches {
+			if o != m && !embeds(m.typ, o.typ) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return m
+		}
+	}
+	return nil
+}
+
+// embeds checks if the struct type outer, or pointed by outer, embeds the type inner, or the type pointed by inner, at any depth
+func embeds(outer, inner reflect.Type) bool {
+	if outer.Kind() == reflect.Ptr {
+		outer = outer.Elem()
+	}
+	if inner.Kind() == reflect.Ptr {
+		inner = inner.Elem()
+	}
+	if outer.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < outer.NumField(); i++ {
+		f := outer.Field(i)
+		if !f.Anonymous {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft == inner || embeds(ft, inner) {
+			return true
+		}
+	}
+	return false
+}
+
+func selectCandidate(t reflect.Type, matches []*injector, selector func(candidates []reflect.Type) reflect.Type) (*injector, error) {
+	candidates := injectorTypes(matches)
+	selected := selector(candidates)
+	for _, m := range matches {
+		if m.typ == selected {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("the selector for interface type %s did not select any of the implementations %v", t, candidates)
+}
+
+func (di *PicoDI) get(ctx context.Context, inj *injector, transient bool, dryRun bool) (interface{}, Clean, error) {
+	if di.collectStats && !dryRun {
+		di.mu.Lock()
+		inj.stats.Resolutions++
+		di.mu.Unlock()
+	}
+	if inj.transient || transient || dryRun {
+		v, clean, err := di.instantiateAndWire(ctx, inj, dryRun)
+		if err == nil && !dryRun {
+			di.mu.Lock()
+			inj.transients++
+			if di.trackTransients && clean != nil {
+				di.transientCleans = append(di.transientCleans, clean)
+			}
+			di.mu.Unlock()
+			if di.transientDisposer != nil {
+				di.transientDisposer(v, clean)
+			}
+		}
+		return v, clean, err
+	}
+	if inj.contextual != nil {
+		return di.getForContext(ctx, inj)
+	}
+
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
 	if inj.instance == nil {
-		provider, clean, err := di.instantiateAndWire(inj, dryRun)
+		provider, clean, err := di.instantiateAndWire(ctx, inj, dryRun)
 		if err != nil {
 			return nil, nil, err
 		}
 		inj.instance = provider
+		inj.addr = reflect.Value{}
+		inj.generation++
+		di.mu.Lock()
+		if inj.generation > 1 {
+			// a singleton instantiated again is only listed once, in its new position
+			di.created = withoutInjector(di.created, inj)
+		}
+		di.created = append(di.created, inj)
+		di.mu.Unlock()
 		if clean != nil {
 			inj.clean = func() {
+				if generation, ok := di.retained[inj]; ok && generation == inj.generation {
+					// kept while cleaning the instances depending on it
+					return
+				}
 				if clean != nil {
 					clean()
 					clean = nil
 				}
-				inj.instance = nil
-				inj.clean = nil
+				inj.instance = nil
+				inj.clean = nil
+			}
+		}
+	}
+
+	if ctx.Value(boundContextKey{}) != nil {
+		// the singleton outlives the context bounded instance depending on it, so it is left to the container to clean
+		return inj.instance, nil, nil
+	}
+	return inj.instance, inj.clean, nil
+}
+
+// withoutInjector returns a new slice with the injectors, except inj
+func withoutInjector(injs []*injector, inj *injector) []*injector {
+	others := make([]*injector, 0, len(injs))
+	for _, i := range injs {
+		if i != inj {
+			others = append(others, i)
+		}
+	}
+	return others
+}
+
+// getForContext returns the instance cached for the context, creating it if needed.
+// The instance is cleaned, and removed from the cache, when the context is done.
+func (di *PicoDI) getForContext(ctx context.Context, inj *injector) (interface{}, Clean, error) {
+	if ctx.Done() == nil {
+		return nil, nil, fmt.Errorf("provider '%s' requires a cancellable context", inj.identifier())
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if bound, ok := ctx.Value(boundContextKey{}).(context.Context); ok && bound.Done() == ctx.Done() {
+		// resolved while constructing an instance bounded by the same context
+		ctx = bound
+	}
+
+	cache := inj.contextual
+	cache.mu.Lock()
+	if ci, ok := cache.instances[ctx]; ok {
+		cache.mu.Unlock()
+		// wait for the instance being created by another resolution of the same context
+		select {
+		case <-ci.ready:
+			return ci.value, nil, ci.err
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+	ci := &contextInstance{ready: make(chan struct{})}
+	cache.instances[ctx] = ci
+	cache.mu.Unlock()
+
+	// other contexts are not blocked by the construction
+	v, clean, err := di.instantiateAndWire(context.WithValue(ctx, boundContextKey{}, ctx), inj, false)
+	if err == nil {
+		err = ctx.Err()
+		if err != nil && clean != nil {
+			clean()
+		}
+	}
+	if err != nil {
+		cache.mu.Lock()
+		delete(cache.instances, ctx)
+		cache.mu.Unlock()
+		ci.err = err
+		close(ci.ready)
+		return nil, nil, err
+	}
+	ci.value = v
+	close(ci.ready)
+
+	go func() {
+		<-ctx.Done()
+		cache.mu.Lock()
+		delete(cache.instances, ctx)
+		cache.mu.Unlock()
+		if clean != nil {
+			clean()
+		}
+	}()
+
+	// the context owns the lifetime of the instance
+	return v, nil, nil
+}
+
+// AddInitializer registers a function, to be called by Init(), for side effects only, like registering metrics.
+// Its arguments are resolved like in Wire(). The function can only return an error.
+//
+//	di.AddInitializer(func(r *Registry) error {...})
+func (di *PicoDI) AddInitializer(fn interface{}) error {
+	if di.frozen {
+		return ErrContainerFrozen
+	}
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return fmt.Errorf("initializer must be a function: %#v", fn)
+	}
+	t := v.Type()
+	if t.NumOut() > 1 || t.NumOut() == 1 && t.Out(0) != errorType {
+		return fmt.Errorf("invalid initializer function '%s'. It should have no return or only return error", t)
+	}
+	di.initializers = append(di.initializers, v)
+	return nil
+}
+
+// RegisterFactory registers a function, to be called by Init(), that can register more providers,
+// eg: a provider per tenant read from a configuration provider.
+func (di *PicoDI) RegisterFactory(fn func(*PicoDI) error) error {
+	if di.frozen {
+		return ErrContainerFrozen
+	}
+	di.factories = append(di.factories, fn)
+	return nil
+}
+
+// OnMissing registers a handler, called when no provider is found for the exact type of zero,
+// eg: OnMissing((*Foo)(nil), fn). For interfaces use a pointer to the interface, eg: (*Greeter)(nil).
+// The handler is called on every resolution and the container does not manage the instance.
+func (di *PicoDI) OnMissing(zero interface{}, fn func() (interface{}, error)) error {
+	if di.frozen {
+		return ErrContainerFrozen
+	}
+	t := reflect.TypeOf(zero)
+	if t == nil || fn == nil {
+		return errors.New("OnMissing requires a typed zero value and a handler")
+	}
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Interface {
+		t = t.Elem()
+	}
+	di.missing[t] = fn
+	return nil
+}
+
+// resolveMissing calls the handler registered with OnMissing for the type t, if any
+func (di *PicoDI) resolveMissing(t reflect.Type, err error, dryRun bool) (interface{}, Clean, error) {
+	fn, ok := di.missing[t]
+	if !ok || !errors.Is(err, ErrProviderNotFound) {
+		return nil, nil, err
+	}
+	if dryRun {
+		return nil, nil, nil
+	}
+	v, err := fn()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to handle missing provider for type %s: %w", t, err)
+	}
+	if v != nil && !reflect.TypeOf(v).AssignableTo(t) {
+		return nil, nil, fmt.Errorf("missing handler for type %s returned the type %T", t, v)
+	}
+	return v, nil, nil
+}
+
+// Init calls the factories and then the initializers, in registration order.
+// With eager validation, the dependencies that were missing at registration are checked before the initializers.
+func (di *PicoDI) Init() error {
+	// a factory is only called once
+	factories := di.factories
+	di.factories = nil
+	for _, fn := range factories {
+		if err := fn(di); err != nil {
+			return fmt.Errorf("factory failed: %w", err)
+		}
+	}
+
+	for _, p := range di.pending {
+		if err := di.checkDependency(p.dependency); err != nil {
+			return fmt.Errorf("invalid dependency %s of provider %s: %w", p.dependency.identifier(), p.provider, err)
+		}
+	}
+	di.pending = nil
+
+	for _, fn := range di.initializers {
+		v, _, err := di.funcInjection(context.Background(), fn, false)
+		if err != nil {
+			return err
+		}
+		if err, ok := v.(error); ok && err != nil {
+			return fmt.Errorf("initializer '%s' failed: %w", fn.Type(), err)
+		}
+	}
+	return nil
+}
+
+// CleanAfter declares that the singleton of the named provider must be cleaned, by Destroy,
+// only after the singletons of the dependsOn providers are cleaned.
+// It is useful when the order can't be inferred from the instantiation order, eg: for value providers.
+func (di *PicoDI) CleanAfter(name string, dependsOn ...string) {
+	di.cleanAfter[name] = append(di.cleanAfter[name], dependsOn...)
+}
+
+// Destroy cleans all the instantiated singletons, in reverse order of instantiation,
+// except for the constraints declared with CleanAfter.
+// With transient tracking, the transient instances are cleaned first, also in reverse order.
+// The singletons will be instantiated again on the next resolution.
+func (di *PicoDI) Destroy() {
+	for i := len(di.transientCleans) - 1; i >= 0; i-- {
+		di.transientCleans[i]()
+	}
+	di.transientCleans = nil
+
+	cleaned := map[*injector]bool{}
+	var destroy func(inj *injector)
+	destroy = func(inj *injector) {
+		if cleaned[inj] {
+			return
+		}
+		// marked before the dependencies, to break cycles
+		cleaned[inj] = true
+		for _, name := range di.cleanAfter[inj.name] {
+			if dep, ok := di.namedInjectors[name]; ok && dep.instance != nil {
+				destroy(dep)
+			}
+		}
+		if inj.clean != nil {
+			inj.clean()
+		}
+		inj.instance = nil
+		inj.clean = nil
+	}
+	for i := len(di.created) - 1; i >= 0; i-- {
+		destroy(di.created[i])
+	}
+	di.created = nil
+
+	for _, fn := range di.onDestroyed {
+		fn()
+	}
+}
+
+// SnapshotInstances captures the current singleton instances and returns a function to restore them.
+// On restore, the singletons instantiated after the snapshot are cleaned, keeping the captured instances they depend on.
+// The captured instances that were cleaned meanwhile, eg: by Destroy, are not restored.
+func (di *PicoDI) SnapshotInstances() func() {
+	snapshot := map[*injector]int{}
+	for _, inj := range di.created {
+		snapshot[inj] = inj.generation
+	}
+	created := append([]*injector{}, di.created...)
+
+	return func() {
+		retained := map[*injector]int{}
+		for _, inj := range created {
+			// an instance discarded after the snapshot, eg: cleaned by Destroy, is instantiated again on the next resolution
+			if inj.instance != nil && inj.generation == snapshot[inj] {
+				retained[inj] = inj.generation
+			}
+		}
+		di.cleanRetaining(retained, func() {
+			for i := len(di.created) - 1; i >= 0; i-- {
+				inj := di.created[i]
+				if _, ok := retained[inj]; ok {
+					continue
+				}
+				if inj.clean != nil {
+					inj.clean()
+				}
+				inj.instance = nil
+				inj.clean = nil
+			}
+		})
+		restored := []*injector{}
+		for _, inj := range created {
+			if _, ok := retained[inj]; ok {
+				restored = append(restored, inj)
+			}
+		}
+		di.created = restored
+	}
+}
+
+// cleanRetaining calls clean without cleaning the retained singletons, even if the cleaned instances depend on them
+func (di *PicoDI) cleanRetaining(retained map[*injector]int, clean func()) {
+	di.retained = retained
+	defer func() {
+		di.retained = nil
+	}()
+	clean()
+}
+
+// instantiable returns the providers, of the active profiles, in registration order followed by the group members,
+// by group name
+func (di *PicoDI) instantiable() []*injector {
+	injs := []*injector{}
+	for _, inj := range di.order {
+		if !di.inactive(inj) {
+			injs = append(injs, inj)
+		}
+	}
+	groups := make([]string, 0, len(di.groups))
+	for group := range di.groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		injs = append(injs, di.groups[group]...)
+	}
+	return injs
+}
+
+// InstantiateAll instantiates every registered provider, running the constructors, and reports all the failures.
+// Afterwards the container is restored: the instances created for the check are cleaned,
+// leaving only the singletons that already existed.
+func (di *PicoDI) InstantiateAll() error {
+	restore := di.SnapshotInstances()
+	defer restore()
+	// the instances bounded by the context are cleaned on cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failures := []string{}
+	for _, inj := range di.instantiable() {
+		_, clean, err := di.get(ctx, inj, false, false)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", inj.identifier(), err))
+			continue
+		}
+		if inj.transient && clean != nil {
+			// the singletons are only cleaned by the restore, leaving the ones that already existed
+			retained := map[*injector]int{}
+			for _, s := range di.created {
+				retained[s] = s.generation
+			}
+			di.cleanRetaining(retained, clean)
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to instantiate %d provider(s): %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// StartAll instantiates all the singleton providers, and starts the ones implementing Starter, in dependency order.
+// If a start fails, the already started instances implementing Stopper are stopped, in reverse order.
+func (di *PicoDI) StartAll(ctx context.Context) error {
+	for _, inj := range di.instantiable() {
+		if inj.transient || inj.contextual != nil {
+			continue
+		}
+		if _, _, err := di.get(ctx, inj, false, false); err != nil {
+			return err
+		}
+	}
+
+	// the singletons are created after their dependencies
+	started := []*injector{}
+	for _, inj := range di.created {
+		starter, ok := inj.instance.(Starter)
+		if !ok {
+			continue
+		}
+		if err := starter.Start(ctx); err != nil {
+			for i := len(started) - 1; i >= 0; i-- {
+				if stopper, ok := started[i].instance.(Stopper); ok {
+					if e := stopper.Stop(ctx); e != nil {
+						di.logger.Debug("stop failed", "provider", started[i].identifier(), "error", e)
+					}
+				}
 			}
+			return fmt.Errorf("failed to start %s: %w", inj.identifier(), err)
 		}
+		started = append(started, inj)
 	}
+	return nil
+}
 
-	return inj.instance, inj.clean, nil
+// TransientCount returns how many transient instances were created by the named provider
+func (di *PicoDI) TransientCount(name string) int {
+	inj, err := di.findByName(name)
+	if err != nil {
+		return 0
+	}
+	return inj.transients
+}
+
+// Disable makes the resolution by name of the named provider to fail with ErrProviderNotFound,
+// until the returned function is called, eg: to simulate a missing dependency in tests.
+func (di *PicoDI) Disable(name string) func() {
+	disabled := []*injector{}
+	for _, inj := range di.order {
+		if name != "" && inj.name == name && !inj.disabled {
+			inj.disabled = true
+			disabled = append(disabled, inj)
+		}
+	}
+	return func() {
+		for _, inj := range disabled {
+			inj.disabled = false
+		}
+	}
+}
+
+// ProviderStats are the resolution metrics of a provider
+type ProviderStats struct {
+	// Resolutions counts the times the provider was resolved, including the cached singleton
+	Resolutions int
+	// Instantiations counts the times the provider was called
+	Instantiations int
+	// Duration is the cumulative duration of the provider calls
+	Duration time.Duration
+}
+
+// Stats are the resolution metrics, by provider identifier
+type Stats map[string]ProviderStats
+
+// Stats returns a snapshot of the resolution metrics of the resolved providers.
+// It is only collected with the option WithStats.
+func (di *PicoDI) Stats() Stats {
+	stats := Stats{}
+	record := func(injs []*injector) {
+		for _, inj := range injs {
+			if inj.stats.Resolutions > 0 {
+				stats[inj.identifier()] = inj.stats
+			}
+		}
+	}
+	record(di.order)
+	for _, members := range di.groups {
+		record(members)
+	}
+	return stats
+}
+
+// LiveInstances returns the currently instantiated singletons, mapped by the provider identifier.
+// Providers that were not instantiated yet are skipped.
+func (di *PicoDI) LiveInstances() map[string]interface{} {
+	instances := make(map[string]interface{}, len(di.created))
+	for _, inj := range di.created {
+		if inj.instance != nil {
+			instances[inj.identifier()] = inj.instance
+		}
+	}
+	return instances
+}
+
+// String lists the providers, in registration order, with their type, if they are transient and if they are instantiated
+func (di *PicoDI) String() string {
+	sb := strings.Builder{}
+	sb.WriteString("PicoDI providers:")
+	for _, inj := range di.order {
+		fmt.Fprintf(&sb, "\n\t%s: type=%s transient=%t instantiated=%t", inj.identifier(), inj.typ, inj.transient, inj.instance != nil)
+	}
+	return sb.String()
+}
+
+// NamesWithPrefix returns, in registration order, the names of the providers starting with the prefix
+func (di *PicoDI) NamesWithPrefix(prefix string) []string {
+	names := []string{}
+	for _, inj := range di.order {
+		if inj.name != "" && strings.HasPrefix(inj.name, prefix) {
+			names = append(names, inj.name)
+		}
+	}
+	return names
+}
+
+// ProvidersWithLabel returns, in registration order, the identifiers of the providers registered with the label
+func (di *PicoDI) ProvidersWithLabel(label string) []string {
+	ids := []string{}
+	for _, inj := range di.order {
+		for _, l := range inj.labels {
+			if l == label {
+				ids = append(ids, inj.identifier())
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// OnDestroyed registers a callback to be called at the end of Destroy(), after all the cleanings.
+// Callbacks are called in registration order.
+func (di *PicoDI) OnDestroyed(fn func()) {
+	di.onDestroyed = append(di.onDestroyed, fn)
 }
 
-func (di *PicoDI) instantiateAndWire(inj *injector, dryRun bool) (interface{}, Clean, error) {
-	v, clean1, err := inj.provider(dryRun)
+func (di *PicoDI) instantiateAndWire(ctx context.Context, inj *injector, dryRun bool) (interface{}, Clean, error) {
+	invoke := func(string) (interface{}, Clean, error) {
+		return inj.provider(ctx, dryRun)
+	}
+	if !dryRun {
+		// the first wrapper is the outermost
+		for i := len(di.wrappers) - 1; i >= 0; i-- {
+			invoke = di.wrappers[i](invoke)
+		}
+	}
+	var start time.Time
+	if di.collectStats {
+		start = time.Now()
+	}
+	v, clean1, err := invoke(inj.identifier())
+	if di.collectStats && !dryRun {
+		di.mu.Lock()
+		inj.stats.Instantiations++
+		inj.stats.Duration += time.Since(start)
+		di.mu.Unlock()
+	}
 	if err != nil {
 		return nil, nil, err
 	}
+	if closer, ok := v.(io.Closer); ok && di.autoClose && !dryRun && !returnsClean(inj.factory) {
+		deps := clean1
+		clean1 = func() {
+			if err := closer.Close(); err != nil {
+				di.logger.Debug("close failed", "provider", inj.identifier(), "error", err)
+			}
+			if deps != nil {
+				deps()
+			}
+		}
+	}
 	var clean2 Clean
 	val := reflect.ValueOf(v)
 	k := val.Kind()
@@ -378,13 +2811,40 @@ func (di *PicoDI) instantiateAndWire(inj *injector, dryRun bool) (interface{}, C
 		ptr := reflect.New(reflect.TypeOf(v))
 		ptr.Elem().Set(val)
 		val = ptr
-		clean2, err = di.wireFields(val, dryRun)
+	} else if k == reflect.Ptr && val.Type().Elem().Kind() == reflect.Struct && val.IsNil() {
+		if dryRun {
+			// the zero value is a nil pointer, but we still want to check the wiring
+			val = reflect.New(val.Type().Elem())
+		} else {
+			val = reflect.Value{}
+		}
+	}
+	if val.Kind() == reflect.Ptr && val.Type().Elem().Kind() == reflect.Struct {
+		if inj.noRewire {
+			clean2, err = di.afterWire(val)
+		} else {
+			clean2, err = di.wireFields(ctx, val, dryRun)
+		}
 		if err != nil {
+			if clean1 != nil {
+				clean1()
+			}
 			return nil, nil, err
 		}
+		if k == reflect.Struct {
+			// the wiring was done on a copy of the struct value
+			v = val.Elem().Interface()
+		}
+	}
+
+	if !dryRun {
+		di.logger.Debug("created instance", "provider", inj.identifier(), "type", inj.typ)
 	}
 
 	c := func() {
+		if clean1 == nil && clean2 == nil {
+			return
+		}
 		if clean1 != nil {
 			clean1()
 			clean1 = nil
@@ -393,6 +2853,7 @@ func (di *PicoDI) instantiateAndWire(inj *injector, dryRun bool) (interface{}, C
 			clean2()
 			clean2 = nil
 		}
+		di.logger.Debug("clean run", "provider", inj.identifier())
 	}
 
 	return v, c, nil
@@ -403,35 +2864,161 @@ func (di *PicoDI) instantiateAndWire(inj *injector, dryRun bool) (interface{}, C
 // After wiring, if the passed value respects the "AfterWirer" interface, "AfterWire() error" will be called
 // A clean function is also returned to do any cleaning, like database disconnecting
 func (di *PicoDI) Wire(value interface{}) (Clean, error) {
-	return di.wire(value, false)
+	return di.wire(context.Background(), value, false)
+}
+
+// WireContext is the same as Wire() but the resolution is aborted if the context is cancelled.
+// Any instance created before the cancellation is cleaned.
+func (di *PicoDI) WireContext(ctx context.Context, value interface{}) (Clean, error) {
+	return di.wire(ctx, value, false)
+}
+
+// WireFuncArgs is the same as Wire() for a function, but the supplied args are used,
+// by position, instead of being resolved. A nil arg is resolved from the container.
+// A clean function is returned to clean the resolved dependencies.
+//
+//	di.WireFuncArgs(func(m Message, g Greeter) {...}, Message("hello"))
+func (di *PicoDI) WireFuncArgs(fn interface{}, args ...interface{}) (Clean, error) {
+	val := reflect.ValueOf(fn)
+	if val.Kind() != reflect.Func {
+		return nil, fmt.Errorf("the wiring must be a 'func (...any) [error]': %#v", fn)
+	}
+	t := val.Type()
+	err := validateWireFunc(t)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > t.NumIn() {
+		return nil, fmt.Errorf("too many arguments for wire function '%s': %d", t, len(args))
+	}
+
+	supplied := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		if arg == nil {
+			continue
+		}
+		v := reflect.ValueOf(arg)
+		if !v.Type().AssignableTo(t.In(i)) {
+			return nil, fmt.Errorf("argument %d of type %s is not assignable to %s in wire function '%s'", i, v.Type(), t.In(i), t)
+		}
+		supplied[i] = v
+	}
+
+	_, clean, err := di.funcInjectionWith(context.Background(), val, supplied, false)
+	if err != nil {
+		return nil, err
+	}
+	return clean, nil
 }
 
 // DryRun checks if existing wiring is possible.
 // It is the same as Wire() but without instantiating anything.
 // This method should be used in unit testing to check if the wiring is correct.
 // This way we avoid to boot the whole application just to check if we made some mistake.
+// All the ambiguous interface dependencies, in the reachable graph, are reported at once.
 func (di *PicoDI) DryRun(value interface{}) (Clean, error) {
-	return di.wire(value, true)
+	var deps []dependency
+	var err error
+	switch t := reflect.TypeOf(value); {
+	case t == nil:
+	case t.Kind() == reflect.Func:
+		deps, err = di.funcDependencies(t)
+	case t.Kind() == reflect.Ptr:
+		deps, err = di.structDependencies(t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if found := di.ambiguities(deps, map[*injector]bool{}); len(found) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMultipleProvidersFound, strings.Join(found, "; "))
+	}
+
+	return di.wire(context.Background(), value, true)
+}
+
+// AssertNoAmbiguity checks that every dependency of all the registered providers can be resolved to a single provider,
+// returning ErrMultipleProvidersFound listing every interface with more than one implementation and no binding.
+func (di *PicoDI) AssertNoAmbiguity() error {
+	var deps []dependency
+	for _, inj := range di.order {
+		if di.inactive(inj) {
+			continue
+		}
+		d, err := di.dependencies(inj)
+		if err != nil {
+			return err
+		}
+		deps = append(deps, d...)
+	}
+
+	found := []string{}
+	seen := map[string]bool{}
+	for _, a := range di.ambiguities(deps, map[*injector]bool{}) {
+		if !seen[a] {
+			seen[a] = true
+			found = append(found, a)
+		}
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("%w: %s", ErrMultipleProvidersFound, strings.Join(found, "; "))
+	}
+	return nil
 }
 
-func (di *PicoDI) wire(value interface{}, dryRun bool) (Clean, error) {
+func (di *PicoDI) wire(ctx context.Context, value interface{}, dryRun bool) (Clean, error) {
 	val := reflect.ValueOf(value)
 	t := val.Kind()
 	if t != reflect.Interface && t != reflect.Ptr && t != reflect.Func {
 		// the first wiring must be valid
 		return nil, fmt.Errorf("the wiring must be an 'interface', 'pointer' or 'func (...any) [error]': %#v", value)
 	}
+	if t == reflect.Ptr && val.IsNil() {
+		return nil, fmt.Errorf("the wiring of %s requires a non nil pointer, eg: &%s{}", val.Type(), val.Type().Elem())
+	}
 
 	if t == reflect.Func {
 		err := validateWireFunc(val.Type())
 		if err != nil {
 			return nil, err
 		}
-		_, _, err = di.funcInjection(val, dryRun)
+		_, _, err = di.funcInjection(ctx, val, dryRun)
 		return nil, err
 	}
 
-	return di.wireFields(val, dryRun)
+	return di.wireFields(ctx, val, dryRun)
+}
+
+// WireConstructor calls the method `Inject` of the struct pointed by value, with its arguments resolved by type,
+// instead of wiring the fields. The method can only return an error.
+// Like Wire(), a clean function is returned to clean the dependencies, including the ones added to an injected Cleaner.
+//
+//	func (s *Service) Inject(g Greeter) {...}
+func (di *PicoDI) WireConstructor(value interface{}) (Clean, error) {
+	val := reflect.ValueOf(value)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("constructor wiring requires a pointer to a struct: %#v", value)
+	}
+	method := val.MethodByName(injectMethodName)
+	if !method.IsValid() {
+		return nil, fmt.Errorf("no method %s was found for type %s", injectMethodName, val.Type())
+	}
+	t := method.Type()
+	if t.NumOut() > 1 || t.NumOut() == 1 && t.Out(0) != errorType {
+		return nil, fmt.Errorf("invalid method %s of type %s. It should have no return or only return error", injectMethodName, val.Type())
+	}
+
+	v, clean, err := di.funcInjection(context.Background(), method, false)
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := v.(error); ok && err != nil {
+		// the dependencies of a failed injection are released
+		if clean != nil {
+			clean()
+		}
+		return nil, err
+	}
+	return clean, nil
 }
 
 func validateWireFunc(t reflect.Type) error {
@@ -454,74 +3041,364 @@ func validateWireFunc(t reflect.Type) error {
 	return nil
 }
 
-func (di *PicoDI) wireFields(val reflect.Value, dryRun bool) (c Clean, err error) {
-	k := val.Kind()
-	if k != reflect.Ptr && k != reflect.Interface {
-		return nil, nil
+// wireTag holds the parsed value of the wire tag
+type wireTag struct {
+	// name is the provider name, empty if the resolution is to be done by type
+	name      string
+	transient bool
+	// setter forces the use of the setter, even if the field is exported
+	setter bool
+	// unexported allows writing directly to an unexported field, in strict mode
+	unexported bool
+	// when is the name of the boolean field that must be true for the field to be wired
+	when string
+}
+
+// parseWireTag splits the wire tag into the provider name and the options, eg: `name,optional,default=x,group:y`.
+// An option is a flag, with an empty value, or a key and value separated by the first '=' or ':'.
+// Blank options and options without key are ignored, and the last of repeated options wins.
+func parseWireTag(tag string) (string, map[string]string) {
+	splits := strings.Split(tag, ",")
+	opts := map[string]string{}
+	for _, v := range splits[1:] {
+		key, value := v, ""
+		if i := strings.IndexAny(v, "=:"); i >= 0 {
+			key, value = v[:i], strings.TrimSpace(v[i+1:])
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		opts[key] = value
 	}
-	// gets the inner struct
-	s := val.Elem()
-	t := s.Type()
+	return strings.TrimSpace(splits[0]), opts
+}
 
-	var cleans []Clean
-	cleanDeps := func() {
-		for _, v := range cleans {
-			v()
+// fieldWireTag returns the wire tag of the field, with the variables of the name expanded
+func (di *PicoDI) fieldWireTag(f reflect.StructField, tag string) (wireTag, error) {
+	name, opts := parseWireTag(tag)
+	wt := wireTag{name: name}
+	_, named := opts[wireFlagNamed]
+	_, wt.transient = opts[wireFlagTransient]
+	_, wt.setter = opts[wireFlagSetter]
+	_, wt.unexported = opts[wireFlagUnexported]
+	wt.when = opts[wireOptionWhen]
+
+	name, err := di.expandVars(wt.name)
+	if err != nil {
+		return wireTag{}, fmt.Errorf("invalid wire tag for field '%s': %w", f.Name, err)
+	}
+	wt.name = name
+
+	if wt.name == "" && named {
+		if di.nameResolver == nil {
+			return wireTag{}, fmt.Errorf("field '%s' is flagged as '%s' but no name resolver was set", f.Name, wireFlagNamed)
 		}
-		cleans = nil
+		wt.name = di.nameResolver(f)
 	}
+	return wt, nil
+}
 
-	defer func() {
-		if err != nil {
-			cleanDeps()
+// nameFromField returns the lowercased field name, if the option WithNameFromField is enabled
+// and there is a provider with that name, otherwise it returns empty
+func (di *PicoDI) nameFromField(f reflect.StructField) string {
+	if !di.fieldNames {
+		return ""
+	}
+	name := strings.ToLower(f.Name)
+	if !di.hasName(name) {
+		return ""
+	}
+	return name
+}
+
+var varPattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// expandVars replaces the variables, in the format ${var}, with the values set with SetVar()
+func (di *PicoDI) expandVars(name string) (string, error) {
+	var err error
+	expanded := varPattern.ReplaceAllStringFunc(name, func(m string) string {
+		key := m[2 : len(m)-1]
+		v, ok := di.vars[key]
+		if !ok && err == nil {
+			err = fmt.Errorf("variable '%s' is not defined", key)
 		}
-	}()
+		return v
+	})
+	return expanded, err
+}
+
+// SetVar sets a variable to be used in wire tags, eg: `wire:"db-${region}"`
+func (di *PicoDI) SetVar(name string, value string) {
+	di.vars[name] = value
+}
+
+// RegisterFieldResolver registers a function to resolve the value of the fields tagged with the prefix,
+// eg: with the prefix `flag`, the field tagged with `wire:"flag:beta"` will be resolved by fn.
+func (di *PicoDI) RegisterFieldResolver(prefix string, fn func(field reflect.StructField) (interface{}, error)) error {
+	if di.frozen {
+		return ErrContainerFrozen
+	}
+	if _, ok := di.fieldResolvers[prefix]; ok {
+		return fmt.Errorf("field resolver already registered for prefix '%s'", prefix)
+	}
+	di.fieldResolvers[prefix] = fn
+	return nil
+}
+
+// fieldResolver returns the field resolver for the prefix of the tag name, if any
+func (di *PicoDI) fieldResolver(name string) (func(field reflect.StructField) (interface{}, error), bool) {
+	idx := strings.Index(name, ":")
+	if idx < 0 {
+		return nil, false
+	}
+	resolver, ok := di.fieldResolvers[name[:idx]]
+	if !ok && di.parent != nil {
+		return di.parent.fieldResolver(name)
+	}
+	return resolver, ok
+}
+
+// plannedField is a struct field relevant for wiring: tagged or embedded
+type plannedField struct {
+	index  int
+	field  reflect.StructField
+	tag    string
+	tagged bool
+}
 
+// fieldPlan returns the fields of the struct type relevant for wiring. The plan is cached by type.
+func (di *PicoDI) fieldPlan(t reflect.Type) []plannedField {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	if plan, ok := di.plans[t]; ok {
+		return plan
+	}
+	plan := []plannedField{}
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
+		tag, ok := f.Tag.Lookup(wireTagKey)
+		if ok || f.Anonymous {
+			plan = append(plan, plannedField{i, f, tag, ok})
+		}
+	}
+	di.plans[t] = plan
+	return plan
+}
+
+// fieldTags returns the wire tags, of the tagged fields of the plan, by plan position.
+// The fields tagged without name get the name derived from the field, if any.
+func (di *PicoDI) fieldTags(plan []plannedField) ([]wireTag, error) {
+	tags := make([]wireTag, len(plan))
+	for j, p := range plan {
+		if !p.tagged {
+			continue
+		}
+		wt, err := di.fieldWireTag(p.field, p.tag)
+		if err != nil {
+			return nil, err
+		}
+		if wt.name == "" {
+			wt.name = di.nameFromField(p.field)
+		}
+		tags[j] = wt
+	}
+	return tags, nil
+}
+
+// wireStruct wires the tagged fields of the struct pointed by val, including the ones of embedded structs.
+// The wire tags are reused from tags, by struct type, and stored there if tags is not nil.
+// The clean functions of the dependencies are appended to cleans.
+func (di *PicoDI) wireStruct(ctx context.Context, val reflect.Value, tags map[reflect.Type][]wireTag, dryRun bool, cleans *[]Clean) error {
+	// gets the inner struct
+	s := val.Elem()
+	t := s.Type()
+
+	plan := di.fieldPlan(t)
+	wts, ok := tags[t]
+	if !ok {
+		var err error
+		wts, err = di.fieldTags(plan)
+		if err != nil {
+			return err
+		}
+		if tags != nil {
+			tags[t] = wts
+		}
+	}
+	for j, p := range plan {
+		i, f := p.index, p.field
+
+		if !p.tagged && f.Anonymous {
+			// fields of embedded structs are wired as if they were fields of the outer struct
+			embedded := embeddedStruct(s.Field(i))
+			if embedded.IsValid() {
+				err := di.wireStruct(ctx, embedded, tags, dryRun, cleans)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if p.tagged {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
-		if name, ok := f.Tag.Lookup(wireTagKey); ok {
-			splits := strings.Split(name, ",")
-			transient := false
-			for _, v := range splits {
-				if v == wireFlagTransient {
-					transient = true
+			var err error
+			wt := wts[j]
+			name, transient := wt.name, wt.transient
+			setterName := "Set" + strings.Title(f.Name)
+			if di.strictUnexported && f.PkgPath != "" && !wt.unexported && !val.MethodByName(setterName).IsValid() {
+				return fmt.Errorf("field '%s' is unexported: add the setter '%s' or the flag '%s'", f.Name, setterName, wireFlagUnexported)
+			}
+			if wt.when != "" {
+				cond := s.FieldByName(wt.when)
+				if !cond.IsValid() || cond.Kind() != reflect.Bool {
+					return fmt.Errorf("condition '%s' of field '%s' is not a boolean field", wt.when, f.Name)
+				}
+				if !cond.Bool() {
+					continue
 				}
 			}
 
 			var v interface{}
-			var err error
 			var clean Clean
-			name = splits[0]
-			if name == "" {
-				v, clean, err = di.getByType(f.Type, transient, dryRun)
+			if resolver, ok := di.fieldResolver(name); ok {
+				if dryRun {
+					continue
+				}
+				v, err = resolver(f)
+				if err == nil && v != nil && !reflect.TypeOf(v).AssignableTo(f.Type) {
+					err = fmt.Errorf("field resolver for '%s' returned type %T, not assignable to field '%s' of type %s", name, v, f.Name, f.Type)
+				}
+			} else if name == "" {
+				v, clean, err = di.getByType(ctx, f.Type, transient, dryRun)
 			} else {
-				v, clean, err = di.getByName(name, transient, dryRun)
+				v, clean, err = di.getByName(ctx, name, transient, dryRun)
+				v = di.coerce(v, f.Type)
+				if err == nil && v != nil && !reflect.TypeOf(v).AssignableTo(f.Type) {
+					if clean != nil {
+						*cleans = append(*cleans, clean)
+					}
+					err = fmt.Errorf("provider '%s' of type %T is not assignable to field '%s' of type %s", name, v, f.Name, f.Type)
+				}
 			}
 			if err != nil {
-				return nil, err
+				return err
 			}
 
 			if clean != nil {
-				cleans = append(cleans, clean)
+				*cleans = append(*cleans, clean)
 			}
 
 			var fieldValue = s.Field(i)
-			if fieldValue.CanSet() {
-				fieldValue.Set(reflect.ValueOf(v))
-			} else if method := val.MethodByName("Set" + strings.Title(f.Name)); method.IsValid() {
+			setter := val.MethodByName(setterName)
+			if wt.setter && !setter.IsValid() {
+				return fmt.Errorf("field '%s' is flagged as '%s' but no setter was found", f.Name, wireFlagSetter)
+			}
+			if fieldValue.CanSet() && !wt.setter {
+				fieldValue.Set(valueOf(v, f.Type))
+			} else if method := setter; method.IsValid() {
 				// Setter defined for the pointer
-				method.Call([]reflect.Value{reflect.ValueOf(v)})
+				method.Call([]reflect.Value{valueOf(v, f.Type)})
 			} else {
 				// Cheat: writting to unexported fields
 				fld := reflect.NewAt(fieldValue.Type(), unsafe.Pointer(fieldValue.UnsafeAddr())).Elem()
-				fld.Set(reflect.ValueOf(v))
+				fld.Set(valueOf(v, f.Type))
+			}
+		}
+	}
+
+	return nil
+}
+
+// embeddedStruct returns a pointer to the embedded struct field.
+// A nil pointer is only allocated if the struct has fields to wire.
+// If the field is not a struct, an invalid value is returned
+func embeddedStruct(field reflect.Value) reflect.Value {
+	// Cheat: the embedded type may be unexported
+	fld := reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr()))
+	if field.Kind() == reflect.Struct {
+		return fld
+	}
+	if field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct {
+		fld = fld.Elem()
+		if fld.IsNil() {
+			if !hasWireTags(field.Type().Elem()) {
+				return reflect.Value{}
 			}
+			fld.Set(reflect.New(field.Type().Elem()))
+		}
+		return fld
+	}
+	return reflect.Value{}
+}
+
+// taggedFields returns the names of the fields of the struct type, including embedded ones, tagged for wiring
+func taggedFields(t reflect.Type) []string {
+	fields := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if _, ok := f.Tag.Lookup(wireTagKey); ok {
+			fields = append(fields, f.Name)
+		} else if f.Anonymous {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, taggedFields(ft)...)
+			}
+		}
+	}
+	return fields
+}
+
+// hasWireTags checks if any field of the struct type is tagged for wiring
+func hasWireTags(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := t.Field(i).Tag.Lookup(wireTagKey); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (di *PicoDI) wireFields(ctx context.Context, val reflect.Value, dryRun bool) (Clean, error) {
+	return di.wireFieldsWith(ctx, val, nil, dryRun)
+}
+
+// wireFieldsWith wires the fields, like wireFields, reusing the wire tags, by struct type, stored in tags
+func (di *PicoDI) wireFieldsWith(ctx context.Context, val reflect.Value, tags map[reflect.Type][]wireTag, dryRun bool) (c Clean, err error) {
+	k := val.Kind()
+	if k != reflect.Ptr && k != reflect.Interface {
+		return nil, nil
+	}
+	var cleans []Clean
+	cleanDeps := func() {
+		for _, v := range cleans {
+			v()
+		}
+		cleans = nil
+	}
+
+	defer func() {
+		if err != nil {
+			cleanDeps()
 		}
+	}()
+
+	err = di.wireStruct(ctx, val, tags, dryRun, &cleans)
+	if err != nil {
+		return nil, err
 	}
 
-	if aw, ok := val.Interface().(AfterWirer); ok {
-		clean, err := aw.AfterWire()
+	clean, err := di.afterWire(val)
+	if err != nil {
+		return nil, err
+	}
+	if clean != nil {
 		c := func() {
 			cleanDeps()
 			if clean != nil {
@@ -529,8 +3406,26 @@ func (di *PicoDI) wireFields(val reflect.Value, dryRun bool) (c Clean, err error
 				clean = nil
 			}
 		}
-		return c, err
+		return c, nil
 	}
 
 	return cleanDeps, nil
 }
+
+// afterWire calls AfterWire() if the value implements AfterWirer or AfterWirerContext
+func (di *PicoDI) afterWire(val reflect.Value) (Clean, error) {
+	var clean Clean
+	var err error
+	switch aw := val.Interface().(type) {
+	case AfterWirerContext:
+		clean, err = aw.AfterWire(di)
+	case AfterWirer:
+		clean, err = aw.AfterWire()
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("after wire of %s failed, with wired fields %v: %w", val.Type(), taggedFields(val.Type().Elem()), err)
+	}
+	return clean, nil
+}
@@ -1,10 +1,15 @@
 package picodi_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/quintans/picodi"
 	"github.com/stretchr/testify/require"
@@ -222,6 +227,95 @@ func TestWireFuncByName(t *testing.T) {
 
 }
 
+func TestWirePointerToValue(t *testing.T) {
+	type Holder struct {
+		Foo *Foo `wire:""`
+	}
+
+	di := picodi.New(picodi.WithPointerToValue(true))
+	err := di.Providers(Foo{"Foo"})
+	require.NoError(t, err)
+
+	h1, h2 := Holder{}, Holder{}
+	_, err = di.Wire(&h1)
+	require.NoError(t, err)
+	_, err = di.Wire(&h2)
+	require.NoError(t, err)
+	require.Equal(t, "Foo", h1.Foo.Name())
+	require.Same(t, h1.Foo, h2.Foo)
+
+	di = picodi.New()
+	err = di.Providers(Foo{"Foo"})
+	require.NoError(t, err)
+	_, err = di.Wire(&Holder{})
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+}
+
+func TestWireLenientPointers(t *testing.T) {
+	di := picodi.New(picodi.WithLenientPointers(true))
+	err := di.Providers(&Foo{"FooPtr"}, Message("hello"))
+	require.NoError(t, err)
+
+	foo, err := picodi.GetByType[Foo](di)
+	require.NoError(t, err)
+	require.Equal(t, "FooPtr", foo.Name())
+
+	msg, err := picodi.GetByType[*Message](di)
+	require.NoError(t, err)
+	require.Equal(t, Message("hello"), *msg)
+
+	// exact match wins
+	err = di.Providers(Foo{"Foo"})
+	require.NoError(t, err)
+	foo, err = picodi.GetByType[Foo](di)
+	require.NoError(t, err)
+	require.Equal(t, "Foo", foo.Name())
+}
+
+func TestWireNameFromField(t *testing.T) {
+	type Store struct {
+		Cache *Foo `wire:""`
+		Other *Foo `wire:""`
+	}
+
+	di := picodi.New(picodi.WithNameFromField(true))
+	err := di.NamedProvider("cache", &Foo{"Cache"})
+	require.NoError(t, err)
+	err = di.Providers(&Foo{"Foo"})
+	require.NoError(t, err)
+
+	s := Store{}
+	_, err = di.Wire(&s)
+	require.NoError(t, err)
+	require.Equal(t, "Cache", s.Cache.Name())
+	require.Equal(t, "Foo", s.Other.Name())
+}
+
+func TestWireUnderlyingMatch(t *testing.T) {
+	type Config struct {
+		Greeting Message `wire:"greeting"`
+		Default  Message `wire:""`
+	}
+
+	di := picodi.New(picodi.WithUnderlyingMatch(true))
+	err := di.Providers("hello")
+	require.NoError(t, err)
+	err = di.NamedProvider("greeting", "hi")
+	require.NoError(t, err)
+
+	config := Config{}
+	_, err = di.Wire(&config)
+	require.NoError(t, err)
+	require.Equal(t, Message("hi"), config.Greeting)
+	require.Equal(t, Message("hello"), config.Default)
+
+	di = picodi.New()
+	err = di.Providers("hello")
+	require.NoError(t, err)
+	_, err = di.Wire(func(m Message) {})
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+}
+
 func TestWire(t *testing.T) {
 	var di = picodi.New()
 	di.NamedProviders(picodi.NamedProviders{
@@ -310,3 +404,2428 @@ func TestWireWithError(t *testing.T) {
 	require.Error(t, err)
 	require.True(t, errors.Is(err, errGrumpy), err)
 }
+
+type Deps struct {
+	picodi.In
+	Greeter Greeter `wire:""`
+	Foo     Foo     `wire:"foo"`
+}
+
+type Service struct {
+	Greeter Greeter
+	Foo     Foo
+}
+
+func TestInStruct(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("foo", Foo{"Foo"})
+	require.NoError(t, err)
+	err = di.Providers(NewMessage, NewGreeter, func(in Deps) *Service {
+		return &Service{Greeter: in.Greeter, Foo: in.Foo}
+	})
+	require.NoError(t, err)
+
+	_, err = di.DryRun(func(s *Service) {})
+	require.NoError(t, err)
+
+	s, _, err := di.GetByType(&Service{})
+	require.NoError(t, err)
+	svc := s.(*Service)
+	require.Equal(t, "Foo", svc.Foo.Name())
+	require.Equal(t, Message("Hi there!"), svc.Greeter.Greet())
+}
+
+type Outputs struct {
+	picodi.Out
+	Foo     Foo `name:"foo"`
+	Message Message
+}
+
+func TestOutStruct(t *testing.T) {
+	counter := 0
+	di := picodi.New()
+	err := di.Providers(func() Outputs {
+		counter++
+		return Outputs{Foo: Foo{"Foo"}, Message: "Hello"}
+	})
+	require.NoError(t, err)
+
+	f, _, err := di.Resolve("foo")
+	require.NoError(t, err)
+	require.Equal(t, "Foo", f.(Foo).Name())
+
+	m, _, err := di.GetByType(Message(""))
+	require.NoError(t, err)
+	require.Equal(t, Message("Hello"), m)
+
+	_, _, err = di.GetByType(Outputs{})
+	require.Error(t, err)
+
+	require.Equal(t, 1, counter, "Out struct provider should be called only once")
+
+	// only the fields can be named
+	err = picodi.New().NamedProvider("outputs", func() Outputs {
+		return Outputs{}
+	})
+	require.Error(t, err)
+}
+
+func TestGetByTypeInterfacePointer(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewGreeter, Message("hello"))
+	require.NoError(t, err)
+
+	g, _, err := di.GetByType((*Greeter)(nil))
+	require.NoError(t, err)
+	require.Equal(t, Message("hello"), g.(Greeter).Greet())
+
+	_, _, err = di.GetByType(nil)
+	require.Error(t, err)
+}
+
+type Cached struct {
+	Cache Foo `wire:",named"`
+}
+
+func TestNameResolver(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("cache", Foo{"Cache"})
+	require.NoError(t, err)
+
+	c := Cached{}
+	_, err = di.Wire(&c)
+	require.Error(t, err)
+
+	di.SetNameResolver(func(field reflect.StructField) string {
+		return strings.ToLower(field.Name)
+	})
+	_, err = di.Wire(&c)
+	require.NoError(t, err)
+	require.Equal(t, "Cache", c.Cache.Name())
+}
+
+func TestExplain(t *testing.T) {
+	di := picodi.New()
+	di.NamedProvider("fooptr", &Foo{"Foo"})
+	di.NamedProvider("foo", Foo{"Foo"})
+	di.NamedProvider("foofn", func() Foo {
+		return Foo{"FooFn"}
+	})
+	di.Providers(Foo{"Foo"})
+
+	explained, err := di.Explain(&Bar{})
+	require.NoError(t, err)
+	require.Equal(t, "foo", explained["Other"])
+	require.Equal(t, "picodi_test.Foo", explained["Foo2"])
+	require.Equal(t, "fooptr", explained["inner"])
+	require.NotContains(t, explained, "afterWire")
+
+	// the same rules as the wiring
+	type Embedded struct {
+		Cache *Foo `wire:""`
+	}
+	type Everything struct {
+		Embedded
+		Connector
+		Beta     bool      `wire:"flag:beta"`
+		Handlers []Handler `wire:""`
+	}
+	di = picodi.New(picodi.WithNameFromField(true))
+	err = di.RegisterFieldResolver("flag", func(field reflect.StructField) (interface{}, error) {
+		return true, nil
+	})
+	require.NoError(t, err)
+	err = di.NamedProviders(picodi.NamedProviders{
+		"cache":  &Foo{"Cache"},
+		"config": &Config{Timeout: 5, DB: &DBConfig{Host: "localhost"}},
+		"auth":   Middleware{"auth"},
+	})
+	require.NoError(t, err)
+
+	e := Everything{}
+	explained, err = di.Explain(&e)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"Cache":    "cache",
+		"Timeout":  "config.Timeout",
+		"Host":     "config.DB.Host",
+		"Beta":     "flag:beta",
+		"Handlers": "[]picodi_test.Handler",
+	}, explained)
+	_, err = di.Wire(&e)
+	require.NoError(t, err)
+
+	_, err = di.Explain(&Connector{})
+	require.NoError(t, err)
+	_, err = picodi.New().Explain(&Connector{})
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+}
+
+type Resources struct {
+	First  Foo     `wire:"first"`
+	Second Message `wire:"second"`
+}
+
+func TestWireContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cleaned := false
+	secondCalled := false
+	di := picodi.New()
+	err := di.NamedProvider("first", func() (Foo, picodi.Clean) {
+		// cancel after the first dependency is resolved
+		cancel()
+		return Foo{"First"}, func() {
+			cleaned = true
+		}
+	})
+	require.NoError(t, err)
+	err = di.NamedProvider("second", func() Message {
+		secondCalled = true
+		return Message("Second")
+	})
+	require.NoError(t, err)
+
+	_, err = di.WireContext(ctx, &Resources{})
+	require.True(t, errors.Is(err, context.Canceled), err)
+	require.True(t, cleaned, "clean of the first dependency was not called")
+	require.False(t, secondCalled, "second dependency should not be resolved")
+}
+
+func TestNamedContextProvider(t *testing.T) {
+	var created, cleaned int32
+	di := picodi.New()
+	err := di.NamedContextProvider("conn", func() (*Foo, picodi.Clean) {
+		n := atomic.AddInt32(&created, 1)
+		return &Foo{fmt.Sprintf("conn-%d", n)}, func() {
+			atomic.AddInt32(&cleaned, 1)
+		}
+	})
+	require.NoError(t, err)
+
+	type Session struct {
+		Conn *Foo `wire:"conn"`
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s1, s2 := Session{}, Session{}
+	_, err = di.WireContext(ctx, &s1)
+	require.NoError(t, err)
+	_, err = di.WireContext(ctx, &s2)
+	require.NoError(t, err)
+	require.Same(t, s1.Conn, s2.Conn)
+
+	other, otherCancel := context.WithCancel(context.Background())
+	defer otherCancel()
+	s3 := Session{}
+	_, err = di.WireContext(other, &s3)
+	require.NoError(t, err)
+	require.NotSame(t, s1.Conn, s3.Conn)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&cleaned) == 1
+	}, time.Second, time.Millisecond)
+
+	_, err = di.Wire(&Session{})
+	require.Error(t, err)
+
+	// an already cancelled context creates nothing
+	_, err = picodi.ResolveContext[*Foo](ctx, di, "conn")
+	require.True(t, errors.Is(err, context.Canceled), err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&created))
+}
+
+func TestNamedContextProviderConcurrent(t *testing.T) {
+	type blockKey struct{}
+	release := make(chan struct{})
+	di := picodi.New()
+	err := di.NamedContextProvider("conn", func(ctx context.Context) *Foo {
+		if ctx.Value(blockKey{}) != nil {
+			<-release
+		}
+		return &Foo{"conn"}
+	})
+	require.NoError(t, err)
+
+	blocked, cancelBlocked := context.WithCancel(context.WithValue(context.Background(), blockKey{}, true))
+	defer cancelBlocked()
+	done := make(chan *Foo)
+	for i := 0; i < 2; i++ {
+		go func() {
+			foo, _ := picodi.ResolveContext[*Foo](blocked, di, "conn")
+			done <- foo
+		}()
+	}
+
+	// the construction for a context does not block the other contexts
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = picodi.ResolveContext[*Foo](ctx, di, "conn")
+	require.NoError(t, err)
+
+	close(release)
+	// the concurrent resolutions of the same context share the instance
+	require.Same(t, <-done, <-done)
+}
+
+func TestNamedContextProviderSingletonDependency(t *testing.T) {
+	var pools, poolsCleaned, conns, connsCleaned int32
+	di := picodi.New()
+	err := di.NamedProvider("pool", func() (*Foo, picodi.Clean) {
+		atomic.AddInt32(&pools, 1)
+		return &Foo{"pool"}, func() {
+			atomic.AddInt32(&poolsCleaned, 1)
+		}
+	})
+	require.NoError(t, err)
+
+	type Conn struct {
+		Pool *Foo `wire:"pool"`
+	}
+	err = di.NamedContextProvider("conn", func() (*Conn, picodi.Clean) {
+		atomic.AddInt32(&conns, 1)
+		return &Conn{}, func() {
+			atomic.AddInt32(&connsCleaned, 1)
+		}
+	})
+	require.NoError(t, err)
+
+	const n = 10
+	cancels := make([]context.CancelFunc, n)
+	results := make(chan *Conn, n)
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+		go func() {
+			conn, err := picodi.ResolveContext[*Conn](ctx, di, "conn")
+			if err != nil {
+				conn = nil
+			}
+			results <- conn
+		}()
+	}
+	var pool *Foo
+	for i := 0; i < n; i++ {
+		conn := <-results
+		require.NotNil(t, conn)
+		if pool == nil {
+			pool = conn.Pool
+		}
+		require.Same(t, pool, conn.Pool)
+	}
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&connsCleaned) == n
+	}, time.Second, time.Millisecond)
+
+	// the shared singleton is only cleaned by the container
+	require.Equal(t, int32(1), atomic.LoadInt32(&pools))
+	require.Equal(t, int32(0), atomic.LoadInt32(&poolsCleaned))
+	di.Destroy()
+	require.Equal(t, int32(1), atomic.LoadInt32(&poolsCleaned))
+}
+
+func TestAsyncProvider(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(func() <-chan *Foo {
+		ch := make(chan *Foo, 1)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			ch <- &Foo{"warm"}
+		}()
+		return ch
+	})
+	require.NoError(t, err)
+
+	foo, err := picodi.GetByType[*Foo](di)
+	require.NoError(t, err)
+	require.Equal(t, "warm", foo.Name())
+
+	di = picodi.New(picodi.WithAsyncTimeout(10 * time.Millisecond))
+	err = di.Providers(func() <-chan *Foo {
+		return make(chan *Foo)
+	})
+	require.NoError(t, err)
+	_, err = picodi.GetByType[*Foo](di)
+	require.Error(t, err)
+}
+
+type Herald struct {
+	greeter Greeter
+}
+
+func (a *Herald) Inject(g Greeter) error {
+	if g == nil {
+		return errors.New("greeter is required")
+	}
+	a.greeter = g
+	return nil
+}
+
+func TestWireConstructor(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewGreeter, Message("hello"))
+	require.NoError(t, err)
+
+	a := Herald{}
+	_, err = di.WireConstructor(&a)
+	require.NoError(t, err)
+	require.Equal(t, Message("hello"), a.greeter.Greet())
+
+	_, err = di.WireConstructor(&Foo{})
+	require.Error(t, err)
+
+	// the resources added to the cleaner are released by the returned clean
+	l := Leaser{}
+	clean, err := di.WireConstructor(&l)
+	require.NoError(t, err)
+	require.False(t, l.released)
+	clean()
+	require.True(t, l.released)
+}
+
+type Leaser struct {
+	released bool
+}
+
+func (l *Leaser) Inject(c picodi.Cleaner) {
+	c.Add(func() {
+		l.released = true
+	})
+}
+
+func TestCleanerOnPartialFailure(t *testing.T) {
+	released := []string{}
+	fail := true
+	di := picodi.New()
+	err := di.Providers(func(c picodi.Cleaner) (*Foo, picodi.Clean, error) {
+		c.Add(func() { released = append(released, "first") })
+		c.Add(func() { released = append(released, "second") })
+		if fail {
+			return nil, nil, errors.New("third failed")
+		}
+		return &Foo{"Foo"}, func() { released = append(released, "foo") }, nil
+	})
+	require.NoError(t, err)
+
+	_, err = picodi.GetByType[*Foo](di)
+	require.EqualError(t, err, "third failed")
+	require.Equal(t, []string{"second", "first"}, released)
+
+	released = []string{}
+	fail = false
+	_, err = picodi.GetByType[*Foo](di)
+	require.NoError(t, err)
+	require.Empty(t, released)
+
+	di.Destroy()
+	require.Equal(t, []string{"foo", "second", "first"}, released)
+}
+
+type Notifier struct {
+	OnEvent func(Event) string `wire:"onEvent"`
+}
+
+func TestWireNamedFuncField(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("onEvent", func(m Message) func(Event) string {
+		return func(e Event) string {
+			return string(m) + " " + e.Start()
+		}
+	})
+	require.NoError(t, err)
+	err = di.Providers(Message("got"))
+	require.NoError(t, err)
+
+	n := Notifier{}
+	_, err = di.Wire(&n)
+	require.NoError(t, err)
+	require.Equal(t, "got hi", n.OnEvent(Event{Greeter: GreeterImpl{Message: "hi"}}))
+
+	di = picodi.New()
+	err = di.NamedProvider("onEvent", func() func(Event) {
+		return func(Event) {}
+	})
+	require.NoError(t, err)
+	_, err = di.Wire(&Notifier{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not assignable to field 'OnEvent'")
+}
+
+type Config struct {
+	Timeout int
+	DB      *DBConfig
+}
+
+type DBConfig struct {
+	Host string
+}
+
+type Connector struct {
+	Timeout int    `wire:"config.Timeout"`
+	Host    string `wire:"config.DB.Host"`
+}
+
+func TestWireConfigPath(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("config", &Config{Timeout: 5, DB: &DBConfig{Host: "localhost"}})
+	require.NoError(t, err)
+
+	_, err = di.DryRun(&Connector{})
+	require.NoError(t, err)
+
+	c := Connector{}
+	_, err = di.Wire(&c)
+	require.NoError(t, err)
+	require.Equal(t, 5, c.Timeout)
+	require.Equal(t, "localhost", c.Host)
+
+	_, err = picodi.Resolve[int](di, "config.Retries")
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+}
+
+type TracedMiddleware struct {
+	Middleware
+}
+
+func (m TracedMiddleware) Handle() string {
+	return "traced " + m.Middleware.Handle()
+}
+
+func TestMostDerived(t *testing.T) {
+	di := picodi.New(picodi.WithMostDerived(true))
+	err := di.Providers(Middleware{"base"}, &TracedMiddleware{Middleware{"base"}})
+	require.NoError(t, err)
+
+	_, err = di.DryRun(func(h Handler) {})
+	require.NoError(t, err)
+	h, err := picodi.GetByType[Handler](di)
+	require.NoError(t, err)
+	require.Equal(t, "traced base", h.Handle())
+
+	// the selector of the interface takes precedence
+	err = di.BindInterfaceFunc((*Handler)(nil), func(candidates []reflect.Type) reflect.Type {
+		return reflect.TypeOf(Middleware{})
+	})
+	require.NoError(t, err)
+	h, err = picodi.GetByType[Handler](di)
+	require.NoError(t, err)
+	require.Equal(t, "base", h.Handle())
+
+	di = picodi.New()
+	err = di.Providers(Middleware{"base"}, &TracedMiddleware{Middleware{"base"}})
+	require.NoError(t, err)
+	_, err = picodi.GetByType[Handler](di)
+	require.True(t, errors.Is(err, picodi.ErrMultipleProvidersFound), err)
+}
+
+func TestNoRewire(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("foo", Foo{"Foo"})
+	require.NoError(t, err)
+	err = di.NamedProvider("bar", &Bar{Foo: Foo{"Preset"}}, picodi.WithNoRewire())
+	require.NoError(t, err)
+
+	bar, err := picodi.Resolve[*Bar](di, "bar")
+	require.NoError(t, err)
+	require.Equal(t, "Preset", bar.Foo.Name())
+}
+
+type Reception struct {
+	Greeter `wire:""`
+}
+
+func TestWireEmbeddedInterface(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewGreeter, Message("welcome"))
+	require.NoError(t, err)
+
+	r := Reception{}
+	_, err = di.Wire(&r)
+	require.NoError(t, err)
+	require.Equal(t, Message("welcome"), r.Greet())
+}
+
+func TestReportUnwired(t *testing.T) {
+	type Lobby struct {
+		Greeter Greeter
+		Message Message `wire:""`
+		Other   Foo
+		greeter Greeter
+	}
+
+	di := picodi.New()
+	err := di.Providers(NewGreeter, Message("hello"))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"Greeter"}, di.ReportUnwired(&Lobby{}))
+}
+
+type Concierge struct {
+	Greeter Greeter `wire:""`
+	Cache   *Foo
+}
+
+func (c *Concierge) AfterWire(di *picodi.PicoDI) (picodi.Clean, error) {
+	// optional dependency
+	cache, err := picodi.Resolve[*Foo](di, "cache")
+	if err == nil {
+		c.Cache = cache
+	}
+	return nil, nil
+}
+
+func TestAfterWirerContext(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewGreeter, Message("hello"))
+	require.NoError(t, err)
+
+	c := Concierge{}
+	_, err = di.Wire(&c)
+	require.NoError(t, err)
+	require.Nil(t, c.Cache)
+
+	err = di.NamedProvider("cache", &Foo{"Cache"})
+	require.NoError(t, err)
+	c = Concierge{}
+	_, err = di.Wire(&c)
+	require.NoError(t, err)
+	require.Equal(t, "Cache", c.Cache.Name())
+}
+
+func TestWireNilPointer(t *testing.T) {
+	di := picodi.New()
+	_, err := di.Wire((*Bar)(nil))
+	require.EqualError(t, err, "the wiring of *picodi_test.Bar requires a non nil pointer, eg: &picodi_test.Bar{}")
+	_, err = di.DryRun((*Bar)(nil))
+	require.Error(t, err)
+}
+
+func TestWireValueProvider(t *testing.T) {
+	type Desk struct {
+		Greeter Greeter `wire:""`
+		Foo     *Foo    `wire:"foo"`
+	}
+
+	di := picodi.New()
+	err := di.Providers(NewGreeter, Message("hello"), Desk{})
+	require.NoError(t, err)
+	err = di.NamedProvider("foo", &Foo{"Foo"})
+	require.NoError(t, err)
+
+	desk, err := picodi.GetByType[Desk](di)
+	require.NoError(t, err)
+	require.Equal(t, Message("hello"), desk.Greeter.Greet())
+	require.Equal(t, "Foo", desk.Foo.Name())
+}
+
+func TestBindInterface(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(Foo{"Foo"}, &Foo{"FooPtr"})
+	require.NoError(t, err)
+
+	_, err = di.Wire(func(n Namer) {})
+	require.Error(t, err)
+
+	err = di.BindInterface((*Namer)(nil), &Foo{})
+	require.NoError(t, err)
+	err = di.BindInterface((*Namer)(nil), Message(""))
+	require.Error(t, err)
+
+	for i := 0; i < 2; i++ {
+		var name string
+		_, err = di.Wire(func(n Namer) {
+			name = n.Name()
+		})
+		require.NoError(t, err)
+		require.Equal(t, "FooPtr", name)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("foo", Foo{"Foo"})
+	require.NoError(t, err)
+
+	di.Freeze()
+
+	err = di.NamedProvider("bar", Foo{"Bar"})
+	require.True(t, errors.Is(err, picodi.ErrContainerFrozen), err)
+	err = di.Providers(NewMessage)
+	require.True(t, errors.Is(err, picodi.ErrContainerFrozen), err)
+
+	f, _, err := di.Resolve("foo")
+	require.NoError(t, err)
+	require.Equal(t, "Foo", f.(Foo).Name())
+}
+
+type Handler interface {
+	Handle() string
+}
+
+type Middleware struct {
+	name string
+}
+
+func (m Middleware) Handle() string {
+	return m.name
+}
+
+func TestCollectInRegistrationOrder(t *testing.T) {
+	di := picodi.New()
+	names := []string{"auth", "logging", "metrics", "recover", "cors"}
+	for _, n := range names {
+		err := di.NamedProvider(n, Middleware{n})
+		require.NoError(t, err)
+	}
+
+	var handlers []Handler
+	_, err := di.Wire(func(hs []Handler) {
+		handlers = hs
+	})
+	require.NoError(t, err)
+
+	require.Len(t, handlers, len(names))
+	for i, h := range handlers {
+		require.Equal(t, names[i], h.Handle())
+	}
+}
+
+type Person struct {
+	name string
+}
+
+func (p *Person) Name() string {
+	return p.name
+}
+
+func (p *Person) String() string {
+	return "Person: " + p.name
+}
+
+type Composed struct {
+	NamedStringer interface {
+		Namer
+		fmt.Stringer
+	} `wire:""`
+}
+
+func TestComposedInterface(t *testing.T) {
+	di := picodi.New()
+	// Foo only implements Namer
+	err := di.Providers(Foo{"Foo"}, &Person{"Ana"})
+	require.NoError(t, err)
+
+	c := Composed{}
+	_, err = di.Wire(&c)
+	require.NoError(t, err)
+	require.Equal(t, "Ana", c.NamedStringer.Name())
+	require.Equal(t, "Person: Ana", c.NamedStringer.String())
+}
+
+func TestMustProvide(t *testing.T) {
+	di := picodi.New()
+	require.NotPanics(t, func() {
+		di.MustNamedProvider("foo", Foo{"Foo"})
+		di.MustProvide(NewMessage, NewGreeter)
+	})
+	require.Panics(t, func() {
+		di.MustNamedProvider("foo", Foo{"Foo2"})
+	})
+	require.Panics(t, func() {
+		di.MustProvide(NewMessage)
+	})
+}
+
+func TestBindInterfaceFunc(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(Foo{"Foo"}, &Person{"Ana"})
+	require.NoError(t, err)
+
+	err = di.BindInterfaceFunc((*Namer)(nil), func(candidates []reflect.Type) reflect.Type {
+		require.Len(t, candidates, 2)
+		for _, c := range candidates {
+			if strings.Contains(c.String(), "Person") {
+				return c
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	var name string
+	_, err = di.Wire(func(n Namer) {
+		name = n.Name()
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Ana", name)
+}
+
+func TestWireFuncArgs(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewMessage, Foo{"Foo"})
+	require.NoError(t, err)
+
+	var greeter *GreeterImpl
+	var foo Foo
+	fn := func(m Message, f Foo) {
+		greeter, _, _ = NewGreeter(m)
+		foo = f
+	}
+	_, err = di.WireFuncArgs(fn, Message("Manual"))
+	require.NoError(t, err)
+	require.Equal(t, Message("Manual"), greeter.Greet())
+	require.Equal(t, "Foo", foo.Name())
+
+	_, err = di.WireFuncArgs(fn, nil, Foo{"Other"})
+	require.NoError(t, err)
+	require.Equal(t, Message("Hi there!"), greeter.Greet())
+	require.Equal(t, "Other", foo.Name())
+
+	_, err = di.WireFuncArgs(fn, 1)
+	require.Error(t, err)
+
+	// the returned clean cleans the resolved arguments
+	cleaned := false
+	err = di.TransientProviders(func() (*Conn, picodi.Clean) {
+		return &Conn{}, func() {
+			cleaned = true
+		}
+	})
+	require.NoError(t, err)
+	clean, err := di.WireFuncArgs(func(m Message, c *Conn) {}, Message("Manual"))
+	require.NoError(t, err)
+	require.False(t, cleaned)
+	clean()
+	require.True(t, cleaned)
+}
+
+type Base struct {
+	Foo     Foo     `wire:"foo"`
+	message Message `wire:""`
+}
+
+type BaseRef struct {
+	Other Namer `wire:"foo"`
+}
+
+type Derived struct {
+	Base
+	*BaseRef
+	Own Foo `wire:""`
+}
+
+func TestWireEmbedded(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("foo", Foo{"Foo"})
+	require.NoError(t, err)
+	err = di.Providers(NewMessage, Foo{"Own"})
+	require.NoError(t, err)
+
+	d := Derived{}
+	_, err = di.Wire(&d)
+	require.NoError(t, err)
+	require.Equal(t, "Foo", d.Foo.Name())
+	require.Equal(t, Message("Hi there!"), d.message)
+	require.NotNil(t, d.BaseRef)
+	require.Equal(t, "Foo", d.Other.Name())
+	require.Equal(t, "Own", d.Own.Name())
+}
+
+func TestDependenciesOf(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("event", NewEvent)
+	require.NoError(t, err)
+	err = di.NamedProvider("bar", &Bar{})
+	require.NoError(t, err)
+
+	deps, err := di.DependenciesOf("event")
+	require.NoError(t, err)
+	require.Equal(t, []string{"picodi_test.Greeter"}, deps)
+
+	deps, err = di.DependenciesOf("bar")
+	require.NoError(t, err)
+	require.Equal(t, []string{"foo", "picodi_test.Foo", "foo", "fooptr", "foo", "foofn", "foofn", "fooptr"}, deps)
+
+	_, err = di.DependenciesOf("missing")
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+}
+
+type Features struct {
+	Beta  bool `wire:"flag:beta"`
+	Alpha bool `wire:"flag:alpha"`
+}
+
+func TestFieldResolver(t *testing.T) {
+	flags := map[string]bool{"beta": true}
+	di := picodi.New()
+	err := di.RegisterFieldResolver("flag", func(field reflect.StructField) (interface{}, error) {
+		tag := field.Tag.Get("wire")
+		return flags[strings.TrimPrefix(tag, "flag:")], nil
+	})
+	require.NoError(t, err)
+
+	f := Features{}
+	_, err = di.DryRun(&f)
+	require.NoError(t, err)
+	require.False(t, f.Beta)
+
+	_, err = di.Wire(&f)
+	require.NoError(t, err)
+	require.True(t, f.Beta)
+	require.False(t, f.Alpha)
+}
+
+var errNotReady = errors.New("not ready")
+
+type NotReady struct {
+	Foo     Foo     `wire:"foo"`
+	Message Message `wire:""`
+}
+
+func (n *NotReady) AfterWire() (picodi.Clean, error) {
+	return nil, errNotReady
+}
+
+func TestAfterWireError(t *testing.T) {
+	cleaned := false
+	di := picodi.New()
+	err := di.NamedProvider("foo", func() (Foo, picodi.Clean) {
+		return Foo{"Foo"}, func() {
+			cleaned = true
+		}
+	})
+	require.NoError(t, err)
+	err = di.Providers(NewMessage)
+	require.NoError(t, err)
+
+	_, err = di.Wire(&NotReady{})
+	require.True(t, errors.Is(err, errNotReady), err)
+	require.Contains(t, err.Error(), "picodi_test.NotReady")
+	require.Contains(t, err.Error(), "[Foo Message]")
+	require.True(t, cleaned, "dependencies were not cleaned")
+}
+
+type Validated struct {
+	Message      Message `wire:",setter"`
+	setterCalled bool
+}
+
+func (v *Validated) SetMessage(m Message) {
+	v.setterCalled = true
+	v.Message = m
+}
+
+type NoSetter struct {
+	Message Message `wire:",setter"`
+}
+
+func TestSetterFlag(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewMessage)
+	require.NoError(t, err)
+
+	v := Validated{}
+	_, err = di.Wire(&v)
+	require.NoError(t, err)
+	require.True(t, v.setterCalled, "setter was not called")
+	require.Equal(t, Message("Hi there!"), v.Message)
+
+	_, err = di.Wire(&NoSetter{})
+	require.Error(t, err)
+}
+
+type Repository struct {
+	DB Foo `wire:"db-${region}"`
+}
+
+func TestWireTagVars(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProviders(picodi.NamedProviders{
+		"db-eu": Foo{"EU"},
+		"db-us": Foo{"US"},
+	})
+	require.NoError(t, err)
+
+	_, err = di.Wire(&Repository{})
+	require.Error(t, err)
+
+	di.SetVar("region", "eu")
+	r := Repository{}
+	_, err = di.Wire(&r)
+	require.NoError(t, err)
+	require.Equal(t, "EU", r.DB.Name())
+}
+
+type Introduction struct {
+	Namer   Namer
+	Handler Handler
+}
+
+func TestDryRunReportsAmbiguities(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(Foo{"Foo"}, &Person{"Ana"}, Middleware{"a"}, &Middleware{"b"})
+	require.NoError(t, err)
+	err = di.NamedProvider("intro", func(n Namer, h Handler) Introduction {
+		return Introduction{n, h}
+	})
+	require.NoError(t, err)
+
+	_, err = di.DryRun(func(m map[picodi.Named]Introduction) {})
+	require.True(t, errors.Is(err, picodi.ErrMultipleProvidersFound), err)
+	require.Contains(t, err.Error(), "picodi_test.Foo")
+	require.Contains(t, err.Error(), "*picodi_test.Person")
+	require.Contains(t, err.Error(), "picodi_test.Middleware")
+	require.Contains(t, err.Error(), "*picodi_test.Middleware")
+}
+
+func TestAssertNoAmbiguity(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(Foo{"Foo"}, &Person{"Ana"}, Middleware{"a"})
+	require.NoError(t, err)
+	err = di.NamedProvider("intro", func(n Namer, h Handler) Introduction {
+		return Introduction{n, h}
+	})
+	require.NoError(t, err)
+
+	err = di.AssertNoAmbiguity()
+	require.True(t, errors.Is(err, picodi.ErrMultipleProvidersFound), err)
+	require.Contains(t, err.Error(), "picodi_test.Namer")
+
+	err = di.BindInterface((*Namer)(nil), &Person{})
+	require.NoError(t, err)
+	require.NoError(t, di.AssertNoAmbiguity())
+
+	// the dependencies of an Out struct provider are the dependencies of its fields
+	di = picodi.New()
+	err = di.Providers(Foo{"Foo"}, &Person{"Ana"})
+	require.NoError(t, err)
+	err = di.Providers(func(n Namer) Outputs {
+		return Outputs{Foo: Foo{n.Name()}, Message: "Hello"}
+	})
+	require.NoError(t, err)
+
+	err = di.AssertNoAmbiguity()
+	require.True(t, errors.Is(err, picodi.ErrMultipleProvidersFound), err)
+	require.Contains(t, err.Error(), "picodi_test.Namer")
+	deps, err := di.DependenciesOf("foo")
+	require.NoError(t, err)
+	require.Equal(t, []string{"picodi_test.Namer"}, deps)
+	_, err = picodi.Resolve[Foo](di, "foo")
+	require.True(t, errors.Is(err, picodi.ErrMultipleProvidersFound), err)
+}
+
+type Engine struct {
+	Foo  Foo `wire:"foo"`
+	Fuel Foo `wire:"fuel,transient"`
+}
+
+type Garage struct {
+	Engines map[picodi.Named]*Engine
+}
+
+func TestCollectNamedWiredPointers(t *testing.T) {
+	cleaned := 0
+	counter := 0
+	di := picodi.New()
+	err := di.NamedProvider("foo", Foo{"Foo"})
+	require.NoError(t, err)
+	err = di.NamedProvider("fuel", func() (Foo, picodi.Clean) {
+		counter++
+		return Foo{fmt.Sprintf("Fuel-%d", counter)}, func() {
+			cleaned++
+		}
+	})
+	require.NoError(t, err)
+	err = di.NamedProvider("diesel", func() *Engine {
+		return &Engine{}
+	})
+	require.NoError(t, err)
+	err = di.NamedTransientProvider("petrol", func() *Engine {
+		return &Engine{}
+	})
+	require.NoError(t, err)
+	err = di.Providers(func(m map[picodi.Named]*Engine) Garage {
+		return Garage{m}
+	})
+	require.NoError(t, err)
+
+	_, err = di.DryRun(func(g Garage) {})
+	require.NoError(t, err)
+
+	g, clean, err := di.GetByType(Garage{})
+	require.NoError(t, err)
+	engines := g.(Garage).Engines
+	require.Len(t, engines, 2)
+	for _, e := range engines {
+		require.Equal(t, "Foo", e.Foo.Name())
+	}
+	require.NotEqual(t, engines["diesel"].Fuel, engines["petrol"].Fuel)
+
+	// singleton is kept but the transient is new
+	var engines2 map[picodi.Named]*Engine
+	_, err = di.Wire(func(m map[picodi.Named]*Engine) {
+		engines2 = m
+	})
+	require.NoError(t, err)
+	require.Same(t, engines["diesel"], engines2["diesel"])
+	require.NotSame(t, engines["petrol"], engines2["petrol"])
+
+	// the cleans of the map members are tracked by the consuming provider
+	clean()
+	require.Equal(t, 2, cleaned)
+}
+
+func TestResolveByTypeKey(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(Foo{"Foo"})
+	require.NoError(t, err)
+
+	f, _, err := di.Resolve("github.com/quintans/picodi_test/Foo")
+	require.NoError(t, err)
+	require.Equal(t, "Foo", f.(Foo).Name())
+
+	di = picodi.New(picodi.WithTypeKeyFunc(func(t reflect.Type) string {
+		return strings.ToLower(t.Name())
+	}))
+	err = di.Providers(Foo{"Foo"})
+	require.NoError(t, err)
+
+	f, _, err = di.Resolve("foo")
+	require.NoError(t, err)
+	require.Equal(t, "Foo", f.(Foo).Name())
+
+	// collisions between type keys and names are rejected
+	err = di.NamedProvider("foo", Bar{})
+	require.EqualError(t, err, "name foo collides with the type key of picodi_test.Foo")
+	err = di.NamedProvider("bar", Bar{})
+	require.NoError(t, err)
+	err = di.Providers(Bar{})
+	require.EqualError(t, err, "type key bar of picodi_test.Bar collides with a provider name")
+}
+
+func TestNamedTransientClones(t *testing.T) {
+	counter := 0
+	di := picodi.New()
+	err := di.NamedTransientClones(func() *Foo {
+		counter++
+		return &Foo{fmt.Sprintf("Conn-%d", counter)}
+	}, "conn1", "conn2", "conn3")
+	require.NoError(t, err)
+
+	instances := map[*Foo]bool{}
+	for _, name := range []string{"conn1", "conn2", "conn3"} {
+		f, _, err := di.Resolve(name)
+		require.NoError(t, err)
+		instances[f.(*Foo)] = true
+	}
+	require.Len(t, instances, 3)
+	require.Equal(t, 3, counter)
+
+	err = di.NamedTransientClones(Foo{}, "conn1")
+	require.Error(t, err)
+}
+
+type Router struct {
+	Handlers []Handler `wire:""`
+}
+
+func TestWireSliceProvider(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("auth", Middleware{"auth"})
+	require.NoError(t, err)
+	err = di.Providers(Middleware{"logging"}, func() []Handler {
+		return []Handler{Middleware{"provided"}}
+	})
+	require.NoError(t, err)
+
+	r := Router{}
+	_, err = di.Wire(&r)
+	require.NoError(t, err)
+	require.Len(t, r.Handlers, 1)
+	require.Equal(t, "provided", r.Handlers[0].Handle())
+}
+
+type capturingLogger struct {
+	entries []string
+}
+
+func (l *capturingLogger) Debug(msg string, kv ...interface{}) {
+	l.entries = append(l.entries, fmt.Sprintf("%s %v", msg, kv))
+}
+
+func TestLogger(t *testing.T) {
+	logger := &capturingLogger{}
+	di := picodi.New()
+	di.SetLogger(logger)
+	err := di.Providers(NewMessage, NewGreeter)
+	require.NoError(t, err)
+	require.Len(t, logger.entries, 2)
+
+	_, err = picodi.GetByType[Greeter](di)
+	require.NoError(t, err)
+	require.Contains(t, logger.entries, "created instance [provider *picodi_test.GreeterImpl type *picodi_test.GreeterImpl]")
+
+	di.Destroy()
+	require.Contains(t, logger.entries, "clean run [provider *picodi_test.GreeterImpl]")
+}
+
+func TestNamedForward(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedForward("logger", "zap-logger")
+	require.NoError(t, err)
+	err = di.NamedProvider("zap-logger", func() *Foo {
+		return &Foo{"zap"}
+	})
+	require.NoError(t, err)
+
+	l, _, err := di.Resolve("logger")
+	require.NoError(t, err)
+	z, _, err := di.Resolve("zap-logger")
+	require.NoError(t, err)
+	require.Same(t, z, l)
+	require.Equal(t, "zap", l.(*Foo).Name())
+
+	err = di.NamedForward("zap-logger", "logger")
+	require.Error(t, err)
+	err = di.NamedProvider("logger", Foo{})
+	require.Error(t, err)
+}
+
+func TestOnDestroyed(t *testing.T) {
+	calls := []string{}
+	di := picodi.New()
+	err := di.Providers(func() (Foo, picodi.Clean) {
+		return Foo{"Foo"}, func() {
+			calls = append(calls, "clean")
+		}
+	})
+	require.NoError(t, err)
+	di.OnDestroyed(func() {
+		calls = append(calls, "first")
+	})
+	di.OnDestroyed(func() {
+		calls = append(calls, "second")
+	})
+
+	_, err = picodi.GetByType[Foo](di)
+	require.NoError(t, err)
+	require.Empty(t, calls)
+
+	di.Destroy()
+	require.Equal(t, []string{"clean", "first", "second"}, calls)
+}
+
+type SelfConfigured struct {
+	EnableCache bool
+	Cache       *Foo `wire:"cache,when=EnableCache"`
+}
+
+type BadCondition struct {
+	Cache *Foo `wire:"cache,when=Missing"`
+}
+
+func TestConditionalWiring(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("cache", &Foo{"Cache"})
+	require.NoError(t, err)
+
+	s := SelfConfigured{}
+	_, err = di.Wire(&s)
+	require.NoError(t, err)
+	require.Nil(t, s.Cache)
+
+	s = SelfConfigured{EnableCache: true}
+	_, err = di.Wire(&s)
+	require.NoError(t, err)
+	require.Equal(t, "Cache", s.Cache.Name())
+
+	_, err = di.Wire(&BadCondition{})
+	require.Error(t, err)
+}
+
+type OrderedMiddleware struct {
+	name  string
+	order int
+}
+
+func (m OrderedMiddleware) Handle() string {
+	return m.name
+}
+
+func (m OrderedMiddleware) Order() int {
+	return m.order
+}
+
+func TestCollectOrdered(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("second", OrderedMiddleware{"second", 2})
+	require.NoError(t, err)
+	err = di.NamedProvider("first", OrderedMiddleware{"first", 1})
+	require.NoError(t, err)
+	err = di.NamedProvider("third", OrderedMiddleware{"third", 3})
+	require.NoError(t, err)
+
+	var handlers []Handler
+	_, err = di.Wire(func(hs []Handler) {
+		handlers = hs
+	})
+	require.NoError(t, err)
+	require.Len(t, handlers, 3)
+	require.Equal(t, "first", handlers[0].Handle())
+	require.Equal(t, "second", handlers[1].Handle())
+	require.Equal(t, "third", handlers[2].Handle())
+}
+
+func TestSnapshotInstances(t *testing.T) {
+	cleaned := []string{}
+	counter := 0
+	di := picodi.New()
+	newFoo := func() (*Foo, picodi.Clean) {
+		counter++
+		f := &Foo{fmt.Sprintf("Foo-%d", counter)}
+		return f, func() {
+			cleaned = append(cleaned, f.name)
+		}
+	}
+	err := di.NamedProvider("a", newFoo)
+	require.NoError(t, err)
+	type Deps struct {
+		picodi.In
+		A *Foo `wire:"a"`
+	}
+	// b depends on a
+	err = di.NamedProvider("b", func(Deps) (*Foo, picodi.Clean) {
+		return newFoo()
+	})
+	require.NoError(t, err)
+
+	a1, err := picodi.Resolve[*Foo](di, "a")
+	require.NoError(t, err)
+
+	restore := di.SnapshotInstances()
+
+	b1, err := picodi.Resolve[*Foo](di, "b")
+	require.NoError(t, err)
+	require.Equal(t, "Foo-2", b1.Name())
+
+	restore()
+	require.Equal(t, []string{"Foo-2"}, cleaned)
+
+	a2, err := picodi.Resolve[*Foo](di, "a")
+	require.NoError(t, err)
+	require.Same(t, a1, a2)
+	b2, err := picodi.Resolve[*Foo](di, "b")
+	require.NoError(t, err)
+	require.Equal(t, "Foo-3", b2.Name())
+
+	// the instances cleaned after the snapshot are not restored
+	restore = di.SnapshotInstances()
+	di.Destroy()
+	restore()
+	a3, err := picodi.Resolve[*Foo](di, "a")
+	require.NoError(t, err)
+	require.Equal(t, "Foo-4", a3.Name())
+	di.Destroy()
+	require.Equal(t, []string{"Foo-2", "Foo-1", "Foo-3", "Foo-4"}, cleaned)
+}
+
+func TestWrapProvider(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewGreeter, NewEvent, Message("hello"))
+	require.NoError(t, err)
+
+	invoked := []string{}
+	di.WrapProvider(func(next picodi.ProviderInvocation) picodi.ProviderInvocation {
+		return func(id string) (interface{}, picodi.Clean, error) {
+			invoked = append(invoked, id)
+			return next(id)
+		}
+	})
+
+	_, err = di.DryRun(func(e Event) {})
+	require.NoError(t, err)
+	require.Empty(t, invoked)
+
+	_, err = di.Wire(func(e Event) {})
+	require.NoError(t, err)
+	require.Equal(t, []string{"picodi_test.Event", "*picodi_test.GreeterImpl", "picodi_test.Message"}, invoked)
+}
+
+func TestTransientDisposer(t *testing.T) {
+	counter := 0
+	cleaned := []string{}
+	di := picodi.New()
+	err := di.NamedTransientProvider("foo", func() (*Foo, picodi.Clean) {
+		counter++
+		f := &Foo{fmt.Sprintf("Foo-%d", counter)}
+		return f, func() {
+			cleaned = append(cleaned, f.name)
+		}
+	})
+	require.NoError(t, err)
+
+	disposed := []picodi.Clean{}
+	instances := []interface{}{}
+	di.SetTransientDisposer(func(instance interface{}, clean picodi.Clean) {
+		instances = append(instances, instance)
+		disposed = append(disposed, clean)
+	})
+
+	f1, err := picodi.Resolve[*Foo](di, "foo")
+	require.NoError(t, err)
+	f2, err := picodi.Resolve[*Foo](di, "foo")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{f1, f2}, instances)
+
+	for _, clean := range disposed {
+		clean()
+	}
+	require.Equal(t, []string{"Foo-1", "Foo-2"}, cleaned)
+}
+
+func TestInstantiateAll(t *testing.T) {
+	cleaned := 0
+	di := picodi.New()
+	err := di.Providers(Message("hello"), NewGreeter, NewEvent)
+	require.NoError(t, err)
+	err = di.NamedProvider("foo", func() (*Foo, picodi.Clean) {
+		return &Foo{"Foo"}, func() {
+			cleaned++
+		}
+	})
+	require.NoError(t, err)
+	require.NoError(t, di.InstantiateAll())
+	require.Equal(t, 1, cleaned)
+	require.Empty(t, di.LiveInstances())
+
+	err = di.NamedProvider("broken", func() (*Foo, error) {
+		return nil, errors.New("boom")
+	})
+	require.NoError(t, err)
+	err = di.InstantiateAll()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "broken: boom")
+
+	// the singletons that already existed are kept, even if a transient depends on them
+	aCleaned := false
+	di = picodi.New()
+	err = di.NamedProvider("a", func() (*Foo, picodi.Clean) {
+		return &Foo{"A"}, func() {
+			aCleaned = true
+		}
+	})
+	require.NoError(t, err)
+	type Deps struct {
+		picodi.In
+		A *Foo `wire:"a"`
+	}
+	err = di.NamedTransientProvider("t", func(d Deps) (*Foo, picodi.Clean) {
+		return &Foo{"T-" + d.A.Name()}, func() {}
+	})
+	require.NoError(t, err)
+	a1, err := picodi.Resolve[*Foo](di, "a")
+	require.NoError(t, err)
+	require.NoError(t, di.InstantiateAll())
+	require.False(t, aCleaned)
+	a2, err := picodi.Resolve[*Foo](di, "a")
+	require.NoError(t, err)
+	require.Same(t, a1, a2)
+}
+
+type Daemon struct {
+	name   string
+	events *[]string
+	fail   bool
+}
+
+func (s *Daemon) Start(ctx context.Context) error {
+	if s.fail {
+		return errors.New("boom")
+	}
+	*s.events = append(*s.events, "start "+s.name)
+	return nil
+}
+
+func (s *Daemon) Stop(ctx context.Context) error {
+	*s.events = append(*s.events, "stop "+s.name)
+	return nil
+}
+
+type Worker struct {
+	*Daemon
+	DB *Daemon `wire:"db"`
+}
+
+func TestStartAll(t *testing.T) {
+	events := []string{}
+	di := picodi.New()
+	err := di.NamedProvider("worker", &Worker{Daemon: &Daemon{name: "worker", events: &events}})
+	require.NoError(t, err)
+	err = di.NamedProvider("db", &Daemon{name: "db", events: &events})
+	require.NoError(t, err)
+
+	err = di.StartAll(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"start db", "start worker"}, events)
+
+	events = []string{}
+	di = picodi.New()
+	err = di.NamedProvider("worker", &Worker{Daemon: &Daemon{name: "worker", events: &events, fail: true}})
+	require.NoError(t, err)
+	err = di.NamedProvider("db", &Daemon{name: "db", events: &events})
+	require.NoError(t, err)
+
+	err = di.StartAll(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to start worker")
+	require.Equal(t, []string{"start db", "stop db"}, events)
+
+	// group, strategy and active profile members are also started
+	events = []string{}
+	di = picodi.New()
+	err = di.AddToGroup("jobs", &Daemon{name: "job", events: &events})
+	require.NoError(t, err)
+	err = di.RegisterStrategy("cron", &Daemon{name: "cron", events: &events})
+	require.NoError(t, err)
+	err = di.NamedProvider("dev", &Daemon{name: "dev", events: &events}, picodi.WithProfile("dev"))
+	require.NoError(t, err)
+	err = di.NamedProvider("prod", &Daemon{name: "prod", events: &events}, picodi.WithProfile("prod"))
+	require.NoError(t, err)
+	di.SetActiveProfiles("prod")
+
+	err = di.StartAll(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"start cron", "start prod", "start job"}, events)
+
+	// a singleton cleaned and instantiated again is only started once
+	events = []string{}
+	di = picodi.New()
+	err = di.NamedProvider("db", func() (*Daemon, picodi.Clean) {
+		return &Daemon{name: "db", events: &events}, func() {}
+	})
+	require.NoError(t, err)
+	_, clean, err := di.Resolve("db")
+	require.NoError(t, err)
+	clean()
+	_, _, err = di.Resolve("db")
+	require.NoError(t, err)
+
+	err = di.StartAll(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"start db"}, events)
+}
+
+type Pool struct{}
+
+func (p *Pool) PicoSingleton() {}
+
+func TestMustSingleton(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedTransientProvider("pool", func() *Pool { return &Pool{} })
+	require.EqualError(t, err, "type *picodi_test.Pool implements MustSingleton and cannot be registered as transient")
+	err = di.TransientProviders(&Pool{})
+	require.Error(t, err)
+
+	err = di.NamedProvider("pool", func() *Pool { return &Pool{} })
+	require.NoError(t, err)
+}
+
+func TestTransientCount(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedTransientProvider("foo", func() *Foo { return &Foo{"Foo"} })
+	require.NoError(t, err)
+	err = di.NamedProvider("bar", func() *Foo { return &Foo{"Bar"} })
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = picodi.Resolve[*Foo](di, "foo")
+		require.NoError(t, err)
+		_, err = picodi.Resolve[*Foo](di, "bar")
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, di.TransientCount("foo"))
+	require.Equal(t, 0, di.TransientCount("bar"))
+	require.Equal(t, 0, di.TransientCount("none"))
+}
+
+func TestTransientTracking(t *testing.T) {
+	cleaned := []string{}
+	counter := 0
+	di := picodi.New(picodi.WithTransientTracking(true))
+	err := di.NamedTransientProvider("foo", func() (*Foo, picodi.Clean) {
+		counter++
+		f := &Foo{fmt.Sprintf("Foo-%d", counter)}
+		return f, func() {
+			cleaned = append(cleaned, f.name)
+		}
+	})
+	require.NoError(t, err)
+
+	_, err = picodi.Resolve[*Foo](di, "foo")
+	require.NoError(t, err)
+	_, err = picodi.Resolve[*Foo](di, "foo")
+	require.NoError(t, err)
+
+	di.Destroy()
+	require.Equal(t, []string{"Foo-2", "Foo-1"}, cleaned)
+}
+
+func TestDisable(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("foo", &Foo{"Foo"})
+	require.NoError(t, err)
+
+	restore := di.Disable("foo")
+	_, err = picodi.Resolve[*Foo](di, "foo")
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+
+	restore()
+	foo, err := picodi.Resolve[*Foo](di, "foo")
+	require.NoError(t, err)
+	require.Equal(t, "Foo", foo.Name())
+}
+
+func TestStats(t *testing.T) {
+	di := picodi.New(picodi.WithStats(true))
+	err := di.Providers(NewGreeter, Message("hello"))
+	require.NoError(t, err)
+	err = di.NamedTransientProvider("foo", func() *Foo { return &Foo{"Foo"} })
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = picodi.GetByType[Greeter](di)
+		require.NoError(t, err)
+		_, err = picodi.Resolve[*Foo](di, "foo")
+		require.NoError(t, err)
+	}
+
+	stats := di.Stats()
+	require.Len(t, stats, 3)
+	require.Equal(t, 3, stats["*picodi_test.GreeterImpl"].Resolutions)
+	require.Equal(t, 1, stats["*picodi_test.GreeterImpl"].Instantiations)
+	require.Equal(t, 1, stats["picodi_test.Message"].Resolutions)
+	require.Equal(t, 3, stats["foo"].Instantiations)
+
+	// group members are also reported
+	err = di.AddToGroup("handlers", Middleware{"auth"})
+	require.NoError(t, err)
+	_, err = picodi.GroupMembers[Handler](di, "handlers")
+	require.NoError(t, err)
+	require.Equal(t, 1, di.Stats()["picodi_test.Middleware"].Instantiations)
+
+	di = picodi.New()
+	err = di.Providers(Message("hello"))
+	require.NoError(t, err)
+	_, err = picodi.GetByType[Message](di)
+	require.NoError(t, err)
+	require.Empty(t, di.Stats())
+}
+
+func TestScopeParentFallback(t *testing.T) {
+	parent := picodi.New()
+	err := parent.Providers(Message("parent"))
+	require.NoError(t, err)
+
+	child := parent.NewScope()
+	err = child.Providers(NewGreeter)
+	require.NoError(t, err)
+
+	// registered in the parent after the scope was created
+	err = parent.NamedProvider("foo", &Foo{"Foo"})
+	require.NoError(t, err)
+
+	foo, err := picodi.Resolve[*Foo](child, "foo")
+	require.NoError(t, err)
+	require.Equal(t, "Foo", foo.Name())
+	parentFoo, err := picodi.Resolve[*Foo](parent, "foo")
+	require.NoError(t, err)
+	require.Same(t, parentFoo, foo)
+
+	g, err := picodi.GetByType[Greeter](child)
+	require.NoError(t, err)
+	require.Equal(t, Message("parent"), g.Greet())
+
+	_, err = picodi.GetByType[Greeter](parent)
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+}
+
+func TestScopeInheritsConfiguration(t *testing.T) {
+	parent := picodi.New(picodi.WithLenientPointers(true), picodi.WithUnderlyingMatch(true))
+	err := parent.Providers(&Foo{"parent"})
+	require.NoError(t, err)
+
+	child := parent.NewScope()
+	err = child.Providers(Foo{"child"}, "hello")
+	require.NoError(t, err)
+
+	// the child pointer/value fallback takes precedence over the parent
+	foo, err := picodi.GetByType[*Foo](child)
+	require.NoError(t, err)
+	require.Equal(t, "child", foo.Name())
+
+	m, err := picodi.GetByType[Message](child)
+	require.NoError(t, err)
+	require.Equal(t, Message("hello"), m)
+}
+
+func TestScopeParentCollections(t *testing.T) {
+	persons := 0
+	parent := picodi.New()
+	err := parent.NamedProviders(picodi.NamedProviders{
+		"auth":    Middleware{"auth"},
+		"logging": Middleware{"logging"},
+	})
+	require.NoError(t, err)
+	err = parent.TransientProviders(func() *Person {
+		persons++
+		return &Person{fmt.Sprintf("Person-%d", persons)}
+	})
+	require.NoError(t, err)
+
+	// only provided by the parent
+	child := parent.NewScope()
+	handlers, err := picodi.GetByType[[]Handler](child)
+	require.NoError(t, err)
+	require.Len(t, handlers, 2)
+	named, err := picodi.GetByType[map[picodi.Named]Handler](child)
+	require.NoError(t, err)
+	require.Len(t, named, 2)
+	factory, err := picodi.GetByType[func() (*Person, error)](child)
+	require.NoError(t, err)
+	p1, err := factory()
+	require.NoError(t, err)
+	p2, err := factory()
+	require.NoError(t, err)
+	require.NotSame(t, p1, p2)
+
+	// the parent providers are followed by the child ones, that replace the parent ones with the same name
+	err = child.NamedProvider("logging", Middleware{"child-logging"})
+	require.NoError(t, err)
+	err = child.NamedProvider("cors", Middleware{"cors"})
+	require.NoError(t, err)
+	handlers, err = picodi.GetByType[[]Handler](child)
+	require.NoError(t, err)
+	require.Len(t, handlers, 4)
+	require.Equal(t, "cors", handlers[3].Handle())
+	named, err = picodi.GetByType[map[picodi.Named]Handler](child)
+	require.NoError(t, err)
+	require.Len(t, named, 3)
+	require.Equal(t, "child-logging", named["logging"].Handle())
+	require.Equal(t, "auth", named["auth"].Handle())
+
+	// the parent is not affected by the child
+	named, err = picodi.GetByType[map[picodi.Named]Handler](parent)
+	require.NoError(t, err)
+	require.Len(t, named, 2)
+}
+
+func TestScopeParentConfiguration(t *testing.T) {
+	type Store struct {
+		Cache *Foo `wire:""`
+	}
+
+	parent := picodi.New(picodi.WithNameFromField(true))
+	err := parent.RegisterFieldResolver("flag", func(field reflect.StructField) (interface{}, error) {
+		return field.Name == "Beta", nil
+	})
+	require.NoError(t, err)
+	err = parent.NamedProvider("cache", &Foo{"Cache"})
+	require.NoError(t, err)
+	err = parent.Providers(&Foo{"Foo"}, NewMessage, NewGreeter)
+	require.NoError(t, err)
+	err = parent.BindInterface((*Namer)(nil), &Person{})
+	require.NoError(t, err)
+	err = parent.BindInterfaceFunc((*Handler)(nil), func(candidates []reflect.Type) reflect.Type {
+		return reflect.TypeOf(Middleware{})
+	})
+	require.NoError(t, err)
+	err = parent.AliasType((*Greeter)(nil), &GreeterImpl{})
+	require.NoError(t, err)
+	err = parent.OnMissing((*Engine)(nil), func() (interface{}, error) {
+		return &Engine{}, nil
+	})
+	require.NoError(t, err)
+
+	child := parent.NewScope()
+	err = child.Providers(Foo{"Foo"}, &Person{"Ana"}, Middleware{"auth"}, OrderedMiddleware{}, LoudGreeter{})
+	require.NoError(t, err)
+
+	f := Features{}
+	_, err = child.Wire(&f)
+	require.NoError(t, err)
+	require.True(t, f.Beta)
+	require.False(t, f.Alpha)
+
+	s := Store{}
+	_, err = child.Wire(&s)
+	require.NoError(t, err)
+	require.Equal(t, "Cache", s.Cache.Name())
+
+	namer, err := picodi.GetByType[Namer](child)
+	require.NoError(t, err)
+	require.Equal(t, "Ana", namer.Name())
+
+	handler, err := picodi.GetByType[Handler](child)
+	require.NoError(t, err)
+	require.Equal(t, "auth", handler.Handle())
+
+	// the alias of the parent takes precedence over the child implementation
+	greeter, err := picodi.GetByType[Greeter](child)
+	require.NoError(t, err)
+	impl, err := picodi.GetByType[*GreeterImpl](parent)
+	require.NoError(t, err)
+	require.Same(t, impl, greeter)
+
+	engine, err := picodi.GetByType[*Engine](child)
+	require.NoError(t, err)
+	require.NotNil(t, engine)
+}
+
+type Conn struct {
+	closed bool
+}
+
+func (c *Conn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestAutoClose(t *testing.T) {
+	di := picodi.New(picodi.WithAutoClose(true))
+	err := di.Providers(func() *Conn { return &Conn{} })
+	require.NoError(t, err)
+
+	conn, err := picodi.GetByType[*Conn](di)
+	require.NoError(t, err)
+	require.False(t, conn.closed)
+
+	di.Destroy()
+	require.True(t, conn.closed)
+
+	di = picodi.New()
+	err = di.Providers(func() *Conn { return &Conn{} })
+	require.NoError(t, err)
+	conn, err = picodi.GetByType[*Conn](di)
+	require.NoError(t, err)
+	di.Destroy()
+	require.False(t, conn.closed)
+}
+
+func TestCleanAfter(t *testing.T) {
+	cleaned := []string{}
+	provider := func(name string) func() (*Foo, picodi.Clean) {
+		return func() (*Foo, picodi.Clean) {
+			return &Foo{name}, func() {
+				cleaned = append(cleaned, name)
+			}
+		}
+	}
+	di := picodi.New()
+	err := di.NamedProviders(picodi.NamedProviders{
+		"db":     provider("db"),
+		"cache":  provider("cache"),
+		"worker": provider("worker"),
+	})
+	require.NoError(t, err)
+	// the worker, the last to be instantiated, is only cleaned after the db
+	di.CleanAfter("worker", "db")
+
+	for _, name := range []string{"cache", "db", "worker"} {
+		_, err = picodi.Resolve[*Foo](di, name)
+		require.NoError(t, err)
+	}
+	di.Destroy()
+	require.Equal(t, []string{"db", "worker", "cache"}, cleaned)
+}
+
+func TestInjectFactory(t *testing.T) {
+	type Spawner struct {
+		NewFoo func() (*Foo, error) `wire:""`
+	}
+
+	di := picodi.New()
+	counter := 0
+	cleaned := []string{}
+	err := di.TransientProviders(func() (*Foo, picodi.Clean) {
+		counter++
+		name := fmt.Sprintf("foo-%d", counter)
+		return &Foo{name}, func() {
+			cleaned = append(cleaned, name)
+		}
+	})
+	require.NoError(t, err)
+
+	var factory func() (*Foo, error)
+	_, err = di.Wire(func(f func() (*Foo, error)) {
+		factory = f
+	})
+	require.NoError(t, err)
+	foo1, err := factory()
+	require.NoError(t, err)
+	foo2, err := factory()
+	require.NoError(t, err)
+	require.Equal(t, "foo-1", foo1.name)
+	require.Equal(t, "foo-2", foo2.name)
+	require.NotSame(t, foo1, foo2)
+
+	s := Spawner{}
+	_, err = di.Wire(&s)
+	require.NoError(t, err)
+	foo3, err := s.NewFoo()
+	require.NoError(t, err)
+	require.Equal(t, "foo-3", foo3.name)
+
+	// the factory is only injected if the type can be resolved
+	_, err = di.Wire(func(f func() (*Bar, error)) {})
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+	// to a transient
+	err = di.Providers(&Bar{})
+	require.NoError(t, err)
+	_, err = di.Wire(func(f func() (*Bar, error)) {})
+	require.EqualError(t, err, "the factory of *picodi_test.Bar requires a transient provider, but *picodi_test.Bar is a singleton")
+
+	// the instances created by the factory are not kept by the container
+	di.Destroy()
+	require.Empty(t, cleaned)
+
+	// unless the transients are tracked
+	di = picodi.New(picodi.WithTransientTracking(true))
+	err = di.TransientProviders(func() (*Foo, picodi.Clean) {
+		counter++
+		name := fmt.Sprintf("foo-%d", counter)
+		return &Foo{name}, func() {
+			cleaned = append(cleaned, name)
+		}
+	})
+	require.NoError(t, err)
+	_, err = di.Wire(func(f func() (*Foo, error)) {
+		factory = f
+	})
+	require.NoError(t, err)
+	_, err = factory()
+	require.NoError(t, err)
+	_, err = factory()
+	require.NoError(t, err)
+	di.Destroy()
+	require.Equal(t, []string{"foo-5", "foo-4"}, cleaned)
+}
+
+func TestLiveInstances(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProviders(picodi.NamedProviders{
+		"a": func() *Foo { return &Foo{"a"} },
+		"b": func() *Foo { return &Foo{"b"} },
+		"c": func() *Foo { return &Foo{"c"} },
+	})
+	require.NoError(t, err)
+	require.Empty(t, di.LiveInstances())
+
+	b, err := picodi.Resolve[*Foo](di, "b")
+	require.NoError(t, err)
+
+	live := di.LiveInstances()
+	require.Len(t, live, 1)
+	require.Same(t, b, live["b"])
+}
+
+func TestNamesWithPrefix(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("plugin.a", Middleware{"a"})
+	require.NoError(t, err)
+	err = di.NamedProvider("other", Middleware{"other"})
+	require.NoError(t, err)
+	err = di.NamedProvider("plugin.b", Middleware{"b"})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"plugin.a", "plugin.b"}, di.NamesWithPrefix("plugin."))
+	require.Empty(t, di.NamesWithPrefix("none."))
+}
+
+func TestResolveWithMeta(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedTransientProvider("foo", func() *Foo { return &Foo{"Foo"} }, picodi.WithLabels("core"))
+	require.NoError(t, err)
+
+	v, meta, clean, err := di.ResolveWithMeta("foo")
+	require.NoError(t, err)
+	require.NotNil(t, clean)
+	require.Equal(t, "Foo", v.(*Foo).Name())
+	require.Equal(t, picodi.ProviderMeta{
+		Name:      "foo",
+		Type:      reflect.TypeOf(&Foo{}),
+		Transient: true,
+		Labels:    []string{"core"},
+	}, meta)
+}
+
+func TestEachNamed(t *testing.T) {
+	di := picodi.New()
+	for _, name := range []string{"c", "a", "b"} {
+		err := di.NamedProvider(name, Foo{name})
+		require.NoError(t, err)
+	}
+	err := di.Providers(&Foo{"unnamed"})
+	require.NoError(t, err)
+
+	visited := []string{}
+	err = di.EachNamed(func(name string, meta picodi.ProviderMeta) error {
+		require.Equal(t, reflect.TypeOf(Foo{}), meta.Type)
+		visited = append(visited, name)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c", "a", "b"}, visited)
+
+	stop := errors.New("stop")
+	err = di.EachNamed(func(name string, meta picodi.ProviderMeta) error {
+		return stop
+	})
+	require.Equal(t, stop, err)
+}
+
+func TestProvidersWithLabel(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("api", Middleware{"api"}, picodi.WithLabels("http", "public"))
+	require.NoError(t, err)
+	err = di.NamedProvider("admin", Middleware{"admin"}, picodi.WithLabels("http"))
+	require.NoError(t, err)
+	err = di.Provider(Foo{"Foo"}, picodi.WithLabels("public"))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"api", "admin"}, di.ProvidersWithLabel("http"))
+	require.Equal(t, []string{"api", "picodi_test.Foo"}, di.ProvidersWithLabel("public"))
+	require.Empty(t, di.ProvidersWithLabel("private"))
+}
+
+func TestLoadModules(t *testing.T) {
+	greeting := picodi.Module{
+		Name:      "greeting",
+		Providers: []interface{}{NewGreeter, NewEvent},
+		Named:     map[string]interface{}{"welcome": Message("welcome")},
+	}
+	messaging := picodi.Module{
+		Name:      "messaging",
+		Providers: []interface{}{Message("hello")},
+	}
+
+	di := picodi.New()
+	err := di.Load(greeting, messaging)
+	require.NoError(t, err)
+
+	event, err := picodi.GetByType[Event](di)
+	require.NoError(t, err)
+	require.Equal(t, "hello", event.Start())
+	welcome, err := picodi.Resolve[Message](di, "welcome")
+	require.NoError(t, err)
+	require.Equal(t, Message("welcome"), welcome)
+
+	err = di.Load(messaging)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "module messaging: type already registered")
+}
+
+func TestOnMissing(t *testing.T) {
+	di := picodi.New()
+	err := di.OnMissing((*Foo)(nil), func() (interface{}, error) {
+		return &Foo{name: "missing"}, nil
+	})
+	require.NoError(t, err)
+
+	foo, err := picodi.GetByType[*Foo](di)
+	require.NoError(t, err)
+	require.Equal(t, "missing", foo.name)
+
+	// the handler is only called for the exact type
+	_, err = picodi.GetByType[Foo](di)
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+
+	// a registered provider takes precedence
+	err = di.Providers(&Foo{name: "provided"})
+	require.NoError(t, err)
+	_, err = di.Wire(func(f *Foo) {
+		foo = f
+	})
+	require.NoError(t, err)
+	require.Equal(t, "provided", foo.name)
+}
+
+func TestRegisterFactory(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("tenants", []string{"acme", "globex"})
+	require.NoError(t, err)
+	err = di.RegisterFactory(func(di *picodi.PicoDI) error {
+		tenants, err := picodi.Resolve[[]string](di, "tenants")
+		if err != nil {
+			return err
+		}
+		for _, tenant := range tenants {
+			if err := di.NamedProvider("db."+tenant, &Foo{tenant}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, di.Init())
+	require.Equal(t, []string{"db.acme", "db.globex"}, di.NamesWithPrefix("db."))
+	db, err := picodi.Resolve[*Foo](di, "db.globex")
+	require.NoError(t, err)
+	require.Equal(t, "globex", db.Name())
+}
+
+func TestEagerValidate(t *testing.T) {
+	di := picodi.New(picodi.WithEagerValidate(true))
+	err := di.Providers(Foo{"Foo"}, &Person{"Ana"}, Middleware{"a"})
+	require.NoError(t, err)
+	err = di.NamedProvider("intro", func(n Namer, h Handler) Introduction {
+		return Introduction{n, h}
+	})
+	require.True(t, errors.Is(err, picodi.ErrMultipleProvidersFound), err)
+	require.Contains(t, err.Error(), "provider intro")
+
+	// registered before its dependency
+	di = picodi.New(picodi.WithEagerValidate(true))
+	err = di.Providers(NewEvent)
+	require.NoError(t, err)
+	err = di.Init()
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+	require.Contains(t, err.Error(), "provider picodi_test.Event")
+
+	err = di.Providers(NewGreeter, Message("hello"))
+	require.NoError(t, err)
+	require.NoError(t, di.Init())
+}
+
+func TestInitializer(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewMessage)
+	require.NoError(t, err)
+
+	err = di.Providers(func() {})
+	require.Error(t, err)
+
+	initialized := false
+	err = di.AddInitializer(func(m Message) {
+		initialized = m != ""
+	})
+	require.NoError(t, err)
+	err = di.AddInitializer(func() Message { return "" })
+	require.Error(t, err)
+
+	require.False(t, initialized)
+	err = di.Init()
+	require.NoError(t, err)
+	require.True(t, initialized)
+
+	errInit := errors.New("init failed")
+	err = di.AddInitializer(func() error {
+		return errInit
+	})
+	require.NoError(t, err)
+	err = di.Init()
+	require.True(t, errors.Is(err, errInit), err)
+}
+
+type Hidden struct {
+	foo   Foo `wire:"foo"`
+	optIn Foo `wire:"foo,unexported"`
+}
+
+func TestStrictUnexported(t *testing.T) {
+	di := picodi.New(picodi.WithStrictUnexported(true))
+	err := di.NamedProvider("foo", Foo{"Foo"})
+	require.NoError(t, err)
+
+	_, err = di.Wire(&Hidden{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SetFoo")
+
+	h := struct {
+		foo Foo `wire:"foo,unexported"`
+	}{}
+	_, err = di.Wire(&h)
+	require.NoError(t, err)
+	require.Equal(t, "Foo", h.foo.Name())
+
+	// default mode
+	di = picodi.New()
+	err = di.NamedProvider("foo", Foo{"Foo"})
+	require.NoError(t, err)
+	hidden := Hidden{}
+	_, err = di.Wire(&hidden)
+	require.NoError(t, err)
+	require.Equal(t, "Foo", hidden.foo.Name())
+	require.Equal(t, "Foo", hidden.optIn.Name())
+}
+
+type Announcer struct {
+	Greeter Greeter `wire:""`
+}
+
+func TestInterfaceFromNamedProvider(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(NewMessage)
+	require.NoError(t, err)
+	err = di.NamedProvider("greeter", NewGreeter)
+	require.NoError(t, err)
+
+	a := Announcer{}
+	_, err = di.Wire(&a)
+	require.NoError(t, err)
+	g, _, err := di.Resolve("greeter")
+	require.NoError(t, err)
+	require.Same(t, g, a.Greeter)
+
+	// providers registered by type take precedence
+	err = di.Providers(LoudGreeter{})
+	require.NoError(t, err)
+	a = Announcer{}
+	_, err = di.Wire(&a)
+	require.NoError(t, err)
+	require.Equal(t, Message("HI THERE!"), a.Greeter.Greet())
+
+	// genuine ambiguity
+	di = picodi.New()
+	err = di.Providers(NewMessage)
+	require.NoError(t, err)
+	err = di.NamedProviders(picodi.NamedProviders{
+		"greeter": NewGreeter,
+		"loud":    LoudGreeter{},
+	})
+	require.NoError(t, err)
+	_, err = di.Wire(&Announcer{})
+	require.True(t, errors.Is(err, picodi.ErrMultipleProvidersFound), err)
+}
+
+func TestString(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedTransientProvider("event", NewEvent)
+	require.NoError(t, err)
+	err = di.Providers(NewMessage, NewGreeter)
+	require.NoError(t, err)
+	_, err = picodi.GetByType[Greeter](di)
+	require.NoError(t, err)
+
+	s := di.String()
+	require.Contains(t, s, "event: type=picodi_test.Event transient=true instantiated=false")
+	require.Contains(t, s, "*picodi_test.GreeterImpl: type=*picodi_test.GreeterImpl transient=false instantiated=true")
+}
+
+func TestCollectNamedAndTypedOnce(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("auth", Middleware{"auth"}, picodi.WithTypeRegistration())
+	require.NoError(t, err)
+	err = di.Providers(&Middleware{"logging"})
+	require.NoError(t, err)
+
+	m, err := picodi.GetByType[Middleware](di)
+	require.NoError(t, err)
+	require.Equal(t, "auth", m.Handle())
+
+	var handlers []Handler
+	_, err = di.Wire(func(h []Handler) {
+		handlers = h
+	})
+	require.NoError(t, err)
+	require.Len(t, handlers, 2)
+}
+
+func TestTypeRegistrationConflict(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(Middleware{"logging"})
+	require.NoError(t, err)
+
+	// the type is already registered, so the name is not registered either
+	err = di.NamedProvider("auth", Middleware{"auth"}, picodi.WithTypeRegistration())
+	require.EqualError(t, err, "type already registered: picodi_test.Middleware")
+	_, err = picodi.Resolve[Middleware](di, "auth")
+	require.True(t, errors.Is(err, picodi.ErrProviderNotFound), err)
+	require.Empty(t, di.NamesWithPrefix("auth"))
+
+	err = di.NamedProvider("auth", Middleware{"auth"})
+	require.NoError(t, err)
+	m, err := picodi.Resolve[Middleware](di, "auth")
+	require.NoError(t, err)
+	require.Equal(t, "auth", m.Handle())
+}
+
+func TestExcludeFromCollection(t *testing.T) {
+	di := picodi.New()
+	err := di.Providers(Middleware{"auth"}, &Middleware{"logging"})
+	require.NoError(t, err)
+	err = di.NamedProvider("noop", OrderedMiddleware{"noop", 0}, picodi.WithExcludeFromCollection())
+	require.NoError(t, err)
+
+	var handlers []Handler
+	_, err = di.Wire(func(h []Handler) {
+		handlers = h
+	})
+	require.NoError(t, err)
+	require.Len(t, handlers, 2)
+
+	noop, err := picodi.Resolve[OrderedMiddleware](di, "noop")
+	require.NoError(t, err)
+	require.Equal(t, "noop", noop.Handle())
+
+	// the excluded provider is only a fallback
+	di = picodi.New()
+	err = di.NamedProvider("noop", Middleware{"noop"}, picodi.WithExcludeFromCollection())
+	require.NoError(t, err)
+	h, err := picodi.GetByType[Handler](di)
+	require.NoError(t, err)
+	require.Equal(t, "noop", h.Handle())
+}
+
+type Dispatcher struct {
+	Handlers map[picodi.Named]Handler `wire:""`
+	Chain    []Handler                `wire:""`
+}
+
+func TestCollectNamedIntoField(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProvider("second", OrderedMiddleware{"second", 2})
+	require.NoError(t, err)
+	err = di.NamedProvider("first", OrderedMiddleware{"first", 1})
+	require.NoError(t, err)
+
+	r := Dispatcher{}
+	_, err = di.Wire(&r)
+	require.NoError(t, err)
+	require.Len(t, r.Handlers, 2)
+	require.Equal(t, "first", r.Handlers["first"].Handle())
+	require.Equal(t, "second", r.Handlers["second"].Handle())
+	require.Equal(t, "first", r.Chain[0].Handle())
+	require.Equal(t, "second", r.Chain[1].Handle())
+}
+
+func TestCollectSingleIntoSliceField(t *testing.T) {
+	type Pipeline struct {
+		Handlers []Handler `wire:""`
+	}
+
+	di := picodi.New()
+	err := di.Providers(Middleware{"only"})
+	require.NoError(t, err)
+
+	p := Pipeline{}
+	_, err = di.Wire(&p)
+	require.NoError(t, err)
+	require.Len(t, p.Handlers, 1)
+	require.Equal(t, "only", p.Handlers[0].Handle())
+}
+
+func TestCollectNestedNamed(t *testing.T) {
+	di := picodi.New()
+	err := di.NamedProviders(picodi.NamedProviders{
+		"http.auth":    Middleware{"http-auth"},
+		"http.logging": Middleware{"http-logging"},
+		"grpc.auth":    Middleware{"grpc-auth"},
+		"standalone":   Middleware{"standalone"},
+	})
+	require.NoError(t, err)
+
+	var handlers map[picodi.Named]map[picodi.Named]Handler
+	_, err = di.Wire(func(m map[picodi.Named]map[picodi.Named]Handler) {
+		handlers = m
+	})
+	require.NoError(t, err)
+	require.Len(t, handlers, 2)
+	require.Len(t, handlers["http"], 2)
+	require.Equal(t, "http-logging", handlers["http"]["logging"].Handle())
+	require.Equal(t, "grpc-auth", handlers["grpc"]["auth"].Handle())
+}
+
+type ServiceID string
+
+func TestCollectNamedWithCustomKey(t *testing.T) {
+	di := picodi.New(picodi.WithMapKeyTypes(ServiceID("")))
+	err := di.NamedProviders(picodi.NamedProviders{
+		"auth":    Middleware{"auth"},
+		"logging": Middleware{"logging"},
+	})
+	require.NoError(t, err)
+
+	var handlers map[ServiceID]Handler
+	_, err = di.Wire(func(m map[ServiceID]Handler) {
+		handlers = m
+	})
+	require.NoError(t, err)
+	require.Len(t, handlers, 2)
+	require.Equal(t, "auth", handlers[ServiceID("auth")].Handle())
+	require.Equal(t, "logging", handlers[ServiceID("logging")].Handle())
+
+	// without registering the key type, the map is not collected
+	di = picodi.New()
+	err = di.NamedProvider("auth", Middleware{"auth"})
+	require.NoError(t, err)
+	_, err = di.Wire(func(m map[ServiceID]Handler) {})
+	require.Error(t, err)
+}
+
+func TestParseWireTag(t *testing.T) {
+	testCases := []struct {
+		tag  string
+		name string
+		opts map[string]string
+	}{
+		{tag: "", name: "", opts: map[string]string{}},
+		{tag: "foo", name: "foo", opts: map[string]string{}},
+		{tag: ",transient", name: "", opts: map[string]string{"transient": ""}},
+		{tag: "foo,optional", name: "foo", opts: map[string]string{"optional": ""}},
+		{tag: "foo,default=x", name: "foo", opts: map[string]string{"default": "x"}},
+		{tag: "foo,group:y", name: "foo", opts: map[string]string{"group": "y"}},
+		{
+			tag:  "foo,optional,default=x,group:y",
+			name: "foo",
+			opts: map[string]string{"optional": "", "default": "x", "group": "y"},
+		},
+		{tag: "flag:beta,when=Enabled", name: "flag:beta", opts: map[string]string{"when": "Enabled"}},
+		// the value is split by the first separator
+		{tag: ",default=http://host", name: "", opts: map[string]string{"default": "http://host"}},
+		{tag: ",default=", name: "", opts: map[string]string{"default": ""}},
+		// malformed tags
+		{tag: " foo , transient ", name: "foo", opts: map[string]string{"transient": ""}},
+		{tag: "foo,,", name: "foo", opts: map[string]string{}},
+		{tag: "foo,=x,:y", name: "foo", opts: map[string]string{}},
+		{tag: "foo,group:a,group:b", name: "foo", opts: map[string]string{"group": "b"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			name, opts := picodi.ParseWireTag(tc.tag)
+			require.Equal(t, tc.name, name)
+			require.Equal(t, tc.opts, opts)
+		})
+	}
+}
+
+func benchmarkRegister(b *testing.B, options ...picodi.Option) {
+	names := make([]string, 1000)
+	for i := range names {
+		names[i] = fmt.Sprintf("foo-%d", i)
+	}
+	foo := Foo{"Foo"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		di := picodi.New(options...)
+		for _, name := range names {
+			if err := di.NamedProvider(name, foo); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkRegister(b *testing.B) {
+	benchmarkRegister(b)
+}
+
+func BenchmarkRegisterWithCapacity(b *testing.B) {
+	benchmarkRegister(b, picodi.WithCapacity(1000))
+}